@@ -0,0 +1,96 @@
+package exporter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/RocksLabs/kvrocks_exporter/info"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// backupState is what the exporter remembers of the backups of an instance between scrapes
+type backupState struct {
+	// Started is when the exporter first saw the running backup, 0 if none is running
+	Started float64 `json:"started,omitempty"`
+	// LastSuccess is the last_bgsave_time of the last backup seen with a last_bgsave_status of ok
+	LastSuccess float64 `json:"last_success,omitempty"`
+}
+
+/*
+observeBackup updates what is known of the backups of the instance at addr and returns it. lastTime is the
+last_bgsave_time of INFO, the last successful one is kept when a later backup fails or the instance restarts.
+*/
+func (t *changeTracker) observeBackup(addr string, inProgress bool, lastTime float64, ok bool, now float64) backupState {
+	t.Lock()
+	defer t.Unlock()
+
+	st := t.backups[addr]
+	if st == nil {
+		st = &backupState{}
+		t.backups[addr] = st
+	}
+	prev := *st
+	switch {
+	case inProgress && st.Started == 0:
+		st.Started = now
+	case !inProgress:
+		st.Started = 0
+	}
+	if ok && lastTime > st.LastSuccess {
+		st.LastSuccess = lastTime
+	}
+	if *st != prev {
+		t.save()
+	}
+	return *st
+}
+
+/*
+extractBackupMetrics exports the state of the backups of BGSAVE from the Persistence section of INFO. Kvrocks only
+reports the last backup, the age of the last successful one relies on the exporter having seen it succeed.
+*/
+func (e *Exporter) extractBackupMetrics(ch chan<- prometheus.Metric, snap *info.Snapshot) {
+	value := func(key string) (float64, bool) {
+		v, err := strconv.ParseFloat(snap.Value(key), 64)
+		return v, err == nil
+	}
+
+	inProgress, ok := value("bgsave_in_progress")
+	if !ok {
+		// older servers only have the yes or no of the RocksDB section
+		switch snap.Value("is_bgsaving") {
+		case "yes":
+			inProgress = 1
+		case "no":
+			inProgress = 0
+		default:
+			return
+		}
+	}
+	// last_bgsave_time is -1 until the first backup
+	lastTime, _ := value("last_bgsave_time")
+	lastOK := lastTime > 0 && snap.Value("last_bgsave_status") == "ok"
+
+	now := serverTime(snap, time.Now())
+	st := e.changes.observeBackup(targetLabel(e.kvrocksAddr), inProgress == 1, lastTime, lastOK, now)
+
+	e.registerConstMetricGauge(ch, "backup_in_progress", inProgress)
+	if st.Started > 0 {
+		e.registerConstMetricGauge(ch, "backup_in_progress_seconds", now-st.Started)
+	}
+
+	if lastTime > 0 {
+		e.registerConstMetricGauge(ch, "last_backup_timestamp_seconds", lastTime)
+		success := 0.0
+		if lastOK {
+			success = 1
+		}
+		e.registerConstMetricGauge(ch, "last_backup_success", success)
+		if d, ok := value("last_bgsave_time_sec"); ok && d >= 0 {
+			e.registerConstMetricGauge(ch, "last_backup_duration_seconds", d)
+		}
+	}
+	if st.LastSuccess > 0 {
+		e.registerConstMetricGauge(ch, "last_successful_backup_age_seconds", now-st.LastSuccess)
+	}
+}
@@ -0,0 +1,93 @@
+package exporter
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBackupMetrics(t *testing.T) {
+	base := loadTestInfo(t)
+	at := func(info string, seconds string) string {
+		return strings.Replace(info, "server_time_usec:1729245600123456", "server_time_usec:"+seconds+"123456", 1)
+	}
+	running := strings.Replace(base, "bgsave_in_progress:0", "bgsave_in_progress:1", 1)
+	failed := strings.NewReplacer("last_bgsave_time:1729159200", "last_bgsave_time:1729245660", "last_bgsave_status:ok", "last_bgsave_status:err").Replace(base)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	e, err := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", StateFile: path})
+	if err != nil {
+		t.Fatalf("NewKvrocksExporter() err: %s", err)
+	}
+	for i, step := range []struct {
+		info       string
+		inProgress float64
+		running    float64 // -1 if not exported
+		success    float64
+		age        float64
+	}{
+		{info: base, running: -1, success: 1, age: 86400},
+		{info: at(running, "1729245660"), inProgress: 1, running: 0, success: 1, age: 86460},
+		{info: at(running, "1729245720"), inProgress: 1, running: 60, success: 1, age: 86520},
+		// the age of the last successful backup goes on when the next one fails
+		{info: at(failed, "1729245780"), running: -1, age: 86580},
+	} {
+		mfs := gatherInfoMetrics(t, e, step.info)
+		if got, _ := metricValue(mfs, "test_backup_in_progress", nil); got != step.inProgress {
+			t.Errorf("step %d: backup_in_progress got: %v, want: %v", i, got, step.inProgress)
+		}
+		got, ok := metricValue(mfs, "test_backup_in_progress_seconds", nil)
+		if (step.running < 0 && ok) || (step.running >= 0 && (!ok || math.Abs(got-step.running) > 1e-6)) {
+			t.Errorf("step %d: backup_in_progress_seconds got: %v (exported: %v), want: %v", i, got, ok, step.running)
+		}
+		if got, _ := metricValue(mfs, "test_last_backup_success", nil); got != step.success {
+			t.Errorf("step %d: last_backup_success got: %v, want: %v", i, got, step.success)
+		}
+		if got, _ := metricValue(mfs, "test_last_successful_backup_age_seconds", nil); math.Abs(got-step.age-0.123456) > 1e-3 {
+			t.Errorf("step %d: last_successful_backup_age_seconds got: %v, want: %v", i, got, step.age)
+		}
+	}
+
+	mfs := gatherInfoMetrics(t, e, base)
+	for name, want := range map[string]float64{"test_last_backup_timestamp_seconds": 1729159200, "test_last_backup_duration_seconds": 12} {
+		if got, _ := metricValue(mfs, name, nil); got != want {
+			t.Errorf("%s got: %v, want: %v", name, got, want)
+		}
+	}
+
+	// the last successful backup survives a restart of the exporter
+	e, _ = NewKvrocksExporter("localhost:6666", Options{Namespace: "test", StateFile: path})
+	mfs = gatherInfoMetrics(t, e, at(failed, "1729245780"))
+	if got, ok := metricValue(mfs, "test_last_successful_backup_age_seconds", nil); !ok || math.Abs(got-86580.123456) > 1e-3 {
+		t.Errorf("last_successful_backup_age_seconds after a restart got: %v (exported: %v)", got, ok)
+	}
+
+	// nothing but backup_in_progress before the first backup
+	e, _ = NewKvrocksExporter("localhost:6666", Options{Namespace: "test"})
+	mfs = gatherInfoMetrics(t, e, strings.Replace(base, "last_bgsave_time:1729159200", "last_bgsave_time:-1", 1))
+	for _, name := range []string{"test_last_backup_timestamp_seconds", "test_last_backup_success", "test_last_successful_backup_age_seconds"} {
+		if _, ok := mfs[name]; ok {
+			t.Errorf("%s shouldn't be exported before the first backup", name)
+		}
+	}
+}
+
+func TestBackupConfigMetrics(t *testing.T) {
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test"})
+	ch := make(chan prometheus.Metric, 10)
+	if _, err := e.extractConfigMetrics(ch, []string{"backup-dir", "/data/kvrocks/backup", "max-backup-to-keep", "1", "dir", "/data/kvrocks"}); err != nil {
+		t.Fatalf("extractConfigMetrics() err: %s", err)
+	}
+	close(ch)
+
+	var got []string
+	for m := range ch {
+		got = append(got, m.Desc().String())
+	}
+	if len(got) != 2 || !strings.Contains(got[0], "test_backup_dir_info") || !strings.Contains(got[1], "test_config_max_backup_to_keep") {
+		t.Errorf("extractConfigMetrics() got: %v", got)
+	}
+}
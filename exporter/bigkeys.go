@@ -0,0 +1,183 @@
+package exporter
+
+import (
+	"sort"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultBigKeysTopK = 10
+
+// upper bounds of the buckets of the sampled key size histogram
+var bigKeySizeBuckets = []float64{1, 10, 100, 1e3, 1e4, 1e5, 1e6, 1e7}
+
+// commands returning the size of a key by type, in bytes for strings and in elements otherwise
+var keySizeCommands = map[string]string{
+	"string":    "STRLEN",
+	"list":      "LLEN",
+	"hash":      "HLEN",
+	"set":       "SCARD",
+	"zset":      "ZCARD",
+	"stream":    "XLEN",
+	"sortedint": "SICARD",
+}
+
+type bigKey struct {
+	key       string
+	size      float64
+	diskUsage float64 // -1 if DISK USAGE isn't supported
+}
+
+type keySizeHistogram struct {
+	count   uint64
+	sum     float64
+	buckets []uint64 // by bigKeySizeBuckets, not cumulative
+}
+
+// bigKeyPass holds the biggest keys and the size histograms of one walk through the keyspace
+type bigKeyPass struct {
+	top     map[string][]bigKey // by type, biggest first
+	hists   map[string]*keySizeHistogram
+	sampled int
+}
+
+func newBigKeyPass() *bigKeyPass {
+	return &bigKeyPass{top: map[string][]bigKey{}, hists: map[string]*keySizeHistogram{}}
+}
+
+func (p *bigKeyPass) add(typ string, k bigKey, topK int) {
+	p.sampled++
+
+	h := p.hists[typ]
+	if h == nil {
+		h = &keySizeHistogram{buckets: make([]uint64, len(bigKeySizeBuckets))}
+		p.hists[typ] = h
+	}
+	h.count++
+	h.sum += k.size
+	if i := sort.SearchFloat64s(bigKeySizeBuckets, k.size); i < len(bigKeySizeBuckets) {
+		h.buckets[i]++
+	}
+
+	top := p.top[typ]
+	if len(top) >= topK {
+		if k.size <= top[len(top)-1].size {
+			return
+		}
+		top = top[:len(top)-1]
+	}
+	i := sort.Search(len(top), func(i int) bool { return top[i].size < k.size })
+	top = append(top, bigKey{})
+	copy(top[i+1:], top[i:])
+	top[i] = k
+	p.top[typ] = top
+}
+
+/*
+bigKeySampler walks the keyspace with SCAN, a few keys per scrape, and keeps the biggest keys by type.
+The cursor is kept between scrapes, the metrics are the ones of the last complete walk, or of the
+current one until the first walk is complete.
+*/
+type bigKeySampler struct {
+	walker keyWalker
+	pass   *bigKeyPass
+	last   *bigKeyPass
+	passes int
+
+	// set once the server answered DISK USAGE with an unknown command error
+	diskUsageUnsupported bool
+}
+
+func newBigKeySampler() *bigKeySampler {
+	return &bigKeySampler{pass: newBigKeyPass()}
+}
+
+// sampleKey returns the type and size of key, ok is false for keys that are gone or can't be sized
+func (s *bigKeySampler) sampleKey(c redis.Conn, key string) (typ string, k bigKey, ok bool) {
+	typ, err := redis.String(doRedisCmd(c, "TYPE", key))
+	if err != nil || typ == "none" {
+		return "", k, false
+	}
+
+	k = bigKey{key: key, size: -1, diskUsage: -1}
+	if cmd, found := keySizeCommands[typ]; found {
+		if size, err := redis.Int64(doRedisCmd(c, cmd, key)); err == nil {
+			k.size = float64(size)
+		}
+	}
+
+	if !s.diskUsageUnsupported {
+		usage, err := redis.Int64(doRedisCmd(c, "DISK", "USAGE", key))
+		switch {
+		case err == nil:
+			k.diskUsage = float64(usage)
+		case isUnknownCommandErr(err):
+			log.Infof("DISK USAGE isn't supported, not sampling the disk usage of keys anymore")
+			s.diskUsageUnsupported = true
+		}
+	}
+
+	if k.size < 0 {
+		// e.g. bloom filters or JSON documents, sized by their disk usage only
+		if k.diskUsage < 0 {
+			return "", k, false
+		}
+		k.size = k.diskUsage
+	}
+	return typ, k, true
+}
+
+// sample samples up to budget keys from where the last scrape left off
+func (s *bigKeySampler) sample(c redis.Conn, budget, topK int) error {
+	done, err := s.walker.walk(c, budget, func(key string) {
+		if typ, k, ok := s.sampleKey(c, key); ok {
+			s.pass.add(typ, k, topK)
+		}
+	})
+	if done {
+		s.last = s.pass
+		s.pass = newBigKeyPass()
+		s.passes++
+	}
+	return err
+}
+
+func (e *Exporter) extractBigKeyMetrics(ch chan<- prometheus.Metric, c redis.Conn) {
+	topK := e.options.BigKeysTopK
+	if topK <= 0 {
+		topK = defaultBigKeysTopK
+	}
+
+	s := e.bigKeys
+	if err := s.sample(c, e.options.BigKeysScanBudget, topK); err != nil {
+		log.Errorf("Couldn't sample keys for big keys, err: %s", err)
+	}
+	e.registerConstMetric(ch, "big_keys_scan_passes_total", float64(s.passes), prometheus.CounterValue)
+
+	p := s.last
+	if p == nil {
+		p = s.pass
+	}
+	e.registerConstMetricGauge(ch, "big_keys_sampled_keys", float64(p.sampled))
+
+	for typ, top := range p.top {
+		for _, k := range top {
+			e.registerConstMetricGauge(ch, "big_key_size", k.size, k.key, typ)
+			if k.diskUsage >= 0 {
+				e.registerConstMetricGauge(ch, "big_key_disk_usage_bytes", k.diskUsage, k.key, typ)
+			}
+		}
+	}
+
+	for typ, h := range p.hists {
+		buckets := make(map[float64]uint64, len(bigKeySizeBuckets))
+		var cumulative uint64
+		for i, le := range bigKeySizeBuckets {
+			cumulative += h.buckets[i]
+			buckets[le] = cumulative
+		}
+		e.registerHist(ch, "sampled_key_size", h.count, h.sum, buckets, typ)
+	}
+}
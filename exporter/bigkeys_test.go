@@ -0,0 +1,125 @@
+package exporter
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBigKeyPass(t *testing.T) {
+	p := newBigKeyPass()
+	for i, size := range []float64{5, 500, 50, 5000, 0.5, 50} {
+		p.add("hash", bigKey{key: string(rune('a' + i)), size: size}, 3)
+	}
+
+	var keys []string
+	for _, k := range p.top["hash"] {
+		keys = append(keys, k.key)
+	}
+	if want := []string{"d", "b", "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("want the top 3 keys %v, got: %v", want, keys)
+	}
+
+	h := p.hists["hash"]
+	if h.count != 6 || h.sum != 5605.5 {
+		t.Errorf("want count 6 and sum 5605.5, got: %d %v", h.count, h.sum)
+	}
+	// <=1, <=10, <=100, <=1e3, <=1e4
+	if want := []uint64{1, 1, 2, 1, 1, 0, 0, 0}; !reflect.DeepEqual(h.buckets, want) {
+		t.Errorf("want buckets %v, got: %v", want, h.buckets)
+	}
+}
+
+func TestBigKeyMetrics(t *testing.T) {
+	b := testCaptureBundle(t)
+	for _, r := range []struct {
+		cmd []string
+		v   interface{}
+	}{
+		{cmd: []string{"SCAN", "0", "COUNT", "3"}, v: []interface{}{[]byte("17"), []interface{}{[]byte("user:1"), []byte("user:2"), []byte("feed")}}},
+		{cmd: []string{"SCAN", "17", "COUNT", "3"}, v: []interface{}{[]byte("0"), []interface{}{[]byte("gone"), []byte("bf")}}},
+		{cmd: []string{"TYPE", "user:1"}, v: "hash"},
+		{cmd: []string{"TYPE", "user:2"}, v: "hash"},
+		{cmd: []string{"TYPE", "feed"}, v: "list"},
+		{cmd: []string{"TYPE", "gone"}, v: "none"},
+		{cmd: []string{"TYPE", "bf"}, v: "MBbloom--"},
+		{cmd: []string{"HLEN", "user:1"}, v: int64(12)},
+		{cmd: []string{"HLEN", "user:2"}, v: int64(120000)},
+		{cmd: []string{"LLEN", "feed"}, v: int64(900)},
+		{cmd: []string{"DISK", "USAGE", "user:1"}, v: int64(512)},
+		{cmd: []string{"DISK", "USAGE", "user:2"}, v: int64(4 << 20)},
+		{cmd: []string{"DISK", "USAGE", "feed"}, v: int64(64 << 10)},
+		{cmd: []string{"DISK", "USAGE", "bf"}, v: int64(2048)},
+	} {
+		val, err := captureValue(r.v)
+		if err != nil {
+			t.Fatalf("captureValue() err: %s", err)
+		}
+		b.Replies = append(b.Replies, CapturedReply{Command: r.cmd, Reply: val})
+	}
+
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", BigKeysScanBudget: 3, BigKeysTopK: 1, ReplayBundle: b, Registry: prometheus.NewRegistry()})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	// the first scrape only gets through the first SCAN page
+	body := downloadURL(t, ts.URL+"/metrics")
+	for _, want := range []string{
+		`test_big_key_size{key="user:2",type="hash"} 120000`,
+		`test_big_key_disk_usage_bytes{key="user:2",type="hash"} 4.194304e+06`,
+		`test_big_key_size{key="feed",type="list"} 900`,
+		`test_big_keys_sampled_keys 3`,
+		`test_big_keys_scan_passes_total 0`,
+		`test_sampled_key_size_count{type="hash"} 2`,
+		`test_sampled_key_size_bucket{type="hash",le="100"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `key="user:1"`) {
+		t.Errorf("want only the top key per type, have:\n%s", body)
+	}
+
+	body = downloadURL(t, ts.URL+"/metrics")
+	for _, want := range []string{
+		`test_big_key_size{key="bf",type="MBbloom--"} 2048`,
+		`test_big_keys_sampled_keys 4`,
+		`test_big_keys_scan_passes_total 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `key="gone"`) {
+		t.Errorf("want deleted keys to be skipped, have:\n%s", body)
+	}
+}
+
+func TestBigKeyDiskUsageUnsupported(t *testing.T) {
+	b := &CaptureBundle{Version: captureBundleVersion}
+	for _, r := range []struct {
+		cmd []string
+		v   interface{}
+	}{
+		{cmd: []string{"TYPE", "k"}, v: "string"},
+		{cmd: []string{"STRLEN", "k"}, v: int64(10)},
+		{cmd: []string{"DISK", "USAGE", "k"}, v: redis.Error("ERR unknown command `DISK`")},
+	} {
+		val, _ := captureValue(r.v)
+		b.Replies = append(b.Replies, CapturedReply{Command: r.cmd, Reply: val})
+	}
+
+	s := newBigKeySampler()
+	typ, k, ok := s.sampleKey(newReplayConn(b), "k")
+	if !ok || typ != "string" || k.size != 10 || k.diskUsage != -1 {
+		t.Errorf("sampleKey() got: %s %+v %v", typ, k, ok)
+	}
+	if !s.diskUsageUnsupported {
+		t.Errorf("want DISK USAGE to be disabled")
+	}
+}
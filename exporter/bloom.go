@@ -0,0 +1,74 @@
+package exporter
+
+import (
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxProbabilisticKeys caps the bloom filter and HyperLogLog keys found by the patterns
+const maxProbabilisticKeys = 1000
+
+/*
+extractBloomFilterMetrics exports BF.INFO of the keys matching Options.CheckBloomFilters:
+
+	Capacity                   100
+	Size                       240
+	Number of filters          1
+	Number of items inserted   12
+	Expansion rate             2
+
+The fill ratio is the number of items inserted per capacity, the false positive rate of a
+filter rises above the configured error rate once it's above 1.
+*/
+func (e *Exporter) extractBloomFilterMetrics(ch chan<- prometheus.Metric, c redis.Conn) {
+	keys, truncated := scanKeys(c, splitKeyPatterns(e.options.CheckBloomFilters), "", maxProbabilisticKeys)
+	if truncated {
+		log.Warnf("Found more than %d bloom filter keys, only the first ones are exported", len(keys))
+	}
+
+	for _, key := range keys {
+		info, err := replyMap(doRedisCmd(c, "BF.INFO", key))
+		if err != nil {
+			log.Debugf("Couldn't get bloom filter info of %s, err: %s", key, err)
+			continue
+		}
+
+		capacity, capacityErr := replyFloat(info["Capacity"])
+		if capacityErr == nil {
+			e.registerConstMetricGauge(ch, "bloom_filter_capacity", capacity, key)
+		}
+		if v, err := replyFloat(info["Size"]); err == nil {
+			e.registerConstMetricGauge(ch, "bloom_filter_size_bytes", v, key)
+		}
+		if v, err := replyFloat(info["Number of filters"]); err == nil {
+			e.registerConstMetricGauge(ch, "bloom_filter_filters", v, key)
+		}
+		if v, err := replyFloat(info["Expansion rate"]); err == nil {
+			e.registerConstMetricGauge(ch, "bloom_filter_expansion_rate", v, key)
+		}
+		if items, err := replyFloat(info["Number of items inserted"]); err == nil {
+			e.registerConstMetricGauge(ch, "bloom_filter_items_inserted", items, key)
+			if capacityErr == nil && capacity > 0 {
+				e.registerConstMetricGauge(ch, "bloom_filter_fill_ratio", items/capacity, key)
+			}
+		}
+	}
+}
+
+// extractHyperLogLogMetrics exports PFCOUNT of the keys matching Options.CheckHyperLogLogs
+func (e *Exporter) extractHyperLogLogMetrics(ch chan<- prometheus.Metric, c redis.Conn) {
+	keys, truncated := scanKeys(c, splitKeyPatterns(e.options.CheckHyperLogLogs), "", maxProbabilisticKeys)
+	if truncated {
+		log.Warnf("Found more than %d HyperLogLog keys, only the first ones are exported", len(keys))
+	}
+
+	for _, key := range keys {
+		count, err := redis.Int64(doRedisCmd(c, "PFCOUNT", key))
+		if err != nil {
+			log.Debugf("Couldn't count HyperLogLog %s, err: %s", key, err)
+			continue
+		}
+		e.registerConstMetricGauge(ch, "hyperloglog_cardinality", float64(count), key)
+	}
+}
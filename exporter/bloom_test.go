@@ -0,0 +1,65 @@
+package exporter
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBloomFilterAndHyperLogLogMetrics(t *testing.T) {
+	b := testCaptureBundle(t)
+	for _, r := range []struct {
+		cmd []string
+		v   interface{}
+	}{
+		{cmd: []string{"SCAN", "0", "MATCH", "bf:*", "COUNT", "1000"}, v: []interface{}{[]byte("0"), []interface{}{[]byte("bf:emails"), []byte("bf:broken")}}},
+		{cmd: []string{"BF.INFO", "bf:emails"}, v: []interface{}{
+			[]byte("Capacity"), int64(1000),
+			[]byte("Size"), int64(2048),
+			[]byte("Number of filters"), int64(2),
+			[]byte("Number of items inserted"), int64(1250),
+			[]byte("Expansion rate"), int64(2),
+		}},
+		{cmd: []string{"BF.INFO", "bf:broken"}, v: redis.Error("ERR not found")},
+		{cmd: []string{"PFCOUNT", "hll:visitors"}, v: int64(31337)},
+	} {
+		val, err := captureValue(r.v)
+		if err != nil {
+			t.Fatalf("captureValue() err: %s", err)
+		}
+		b.Replies = append(b.Replies, CapturedReply{Command: r.cmd, Reply: val})
+	}
+
+	e, _ := NewKvrocksExporter("localhost:6666", Options{
+		Namespace:         "test",
+		CheckBloomFilters: "bf:*",
+		CheckHyperLogLogs: "hll:visitors,hll:missing",
+		ReplayBundle:      b,
+		Registry:          prometheus.NewRegistry(),
+	})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/metrics")
+	for _, want := range []string{
+		`test_bloom_filter_capacity{key="bf:emails"} 1000`,
+		`test_bloom_filter_size_bytes{key="bf:emails"} 2048`,
+		`test_bloom_filter_filters{key="bf:emails"} 2`,
+		`test_bloom_filter_items_inserted{key="bf:emails"} 1250`,
+		`test_bloom_filter_expansion_rate{key="bf:emails"} 2`,
+		`test_bloom_filter_fill_ratio{key="bf:emails"} 1.25`,
+		`test_hyperloglog_cardinality{key="hll:visitors"} 31337`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+	for _, unwanted := range []string{`key="bf:broken"`, `key="hll:missing"`} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("want no metrics for %s, have:\n%s", unwanted, body)
+		}
+	}
+}
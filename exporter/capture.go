@@ -0,0 +1,378 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+const captureBundleVersion = 1
+
+const redactedValue = "<redacted>"
+
+// CaptureBundle holds the raw replies of a Kvrocks instance to the commands the exporter runs.
+// It's written by the capture subcommand and served by an exporter with Options.ReplayBundle set,
+// which makes it possible to debug what a server returned without having access to it.
+type CaptureBundle struct {
+	Version    int             `json:"version"`
+	Addr       string          `json:"addr"`
+	CapturedAt time.Time       `json:"captured_at"`
+	Replies    []CapturedReply `json:"replies"`
+}
+
+// CapturedReply is the reply of a single command
+type CapturedReply struct {
+	Command []string      `json:"command"`
+	Reply   CapturedValue `json:"reply"`
+}
+
+/*
+CapturedValue is a RESP value, Type is one of:
+
+  - bulk, status and error with the value in Str
+  - int with the value in Int
+  - array with the elements in Array
+  - nil
+*/
+type CapturedValue struct {
+	Type  string          `json:"type"`
+	Str   string          `json:"str,omitempty"`
+	Int   int64           `json:"int,omitempty"`
+	Array []CapturedValue `json:"array,omitempty"`
+}
+
+func captureValue(v interface{}) (CapturedValue, error) {
+	switch v := v.(type) {
+	case nil:
+		return CapturedValue{Type: "nil"}, nil
+	case []byte:
+		return CapturedValue{Type: "bulk", Str: string(v)}, nil
+	case string:
+		return CapturedValue{Type: "status", Str: v}, nil
+	case int64:
+		return CapturedValue{Type: "int", Int: v}, nil
+	case redis.Error:
+		return CapturedValue{Type: "error", Str: string(v)}, nil
+	case []interface{}:
+		res := CapturedValue{Type: "array", Array: make([]CapturedValue, 0, len(v))}
+		for _, el := range v {
+			val, err := captureValue(el)
+			if err != nil {
+				return CapturedValue{}, err
+			}
+			res.Array = append(res.Array, val)
+		}
+		return res, nil
+	}
+	return CapturedValue{}, fmt.Errorf("unsupported reply type %T", v)
+}
+
+// value returns the value like redigo does
+func (v CapturedValue) value() (interface{}, error) {
+	switch v.Type {
+	case "nil":
+		return nil, nil
+	case "bulk":
+		return []byte(v.Str), nil
+	case "status":
+		return v.Str, nil
+	case "int":
+		return v.Int, nil
+	case "error":
+		return nil, redis.Error(v.Str)
+	case "array":
+		res := make([]interface{}, 0, len(v.Array))
+		for _, el := range v.Array {
+			val, err := el.value()
+			// errors nested in arrays are values, like in the replies of redigo
+			if e, ok := err.(redis.Error); ok {
+				val = e
+			} else if err != nil {
+				return nil, err
+			}
+			res = append(res, val)
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("unsupported captured type %q", v.Type)
+}
+
+// isSecretConfig returns whether the value of a config key must not end up in a bundle,
+// namespace.<name> keys hold the tokens of the namespaces
+func isSecretConfig(key string) bool {
+	key = strings.ToLower(key)
+	return strings.Contains(key, "pass") || strings.Contains(key, "auth") ||
+		strings.Contains(key, "secret") || strings.HasPrefix(key, "namespace.")
+}
+
+// redactConfig replaces the secrets of a CONFIG GET * reply
+func redactConfig(v CapturedValue) CapturedValue {
+	if v.Type != "array" {
+		return v
+	}
+	res := v
+	res.Array = append([]CapturedValue(nil), v.Array...)
+	for i := 0; i+1 < len(res.Array); i += 2 {
+		if isSecretConfig(res.Array[i].Str) && res.Array[i+1].Str != "" {
+			res.Array[i+1] = CapturedValue{Type: "bulk", Str: redactedValue}
+		}
+	}
+	return res
+}
+
+// redactedInfoFields are the INFO fields with paths and hosts of the instance and its master
+var redactedInfoFields = map[string]bool{
+	"executable":  true,
+	"config_file": true,
+	"master_host": true,
+}
+
+// redactInfo replaces the paths and hosts of an INFO reply, including the ip of the replicas in the slave<n> fields
+func redactInfo(v CapturedValue) CapturedValue {
+	if v.Type != "bulk" {
+		return v
+	}
+	lines := strings.Split(v.Str, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSuffix(line, "\r")
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok || value == "" {
+			continue
+		}
+		switch {
+		case redactedInfoFields[key]:
+			value = redactedValue
+		case strings.HasPrefix(key, "slave") && strings.Contains(value, "ip="):
+			pairs := strings.Split(value, ",")
+			for j, pair := range pairs {
+				if strings.HasPrefix(pair, "ip=") {
+					pairs[j] = "ip=" + redactedValue
+				}
+			}
+			value = strings.Join(pairs, ",")
+		default:
+			continue
+		}
+		lines[i] = key + ":" + value + strings.TrimPrefix(line, trimmed)
+	}
+	res := v
+	res.Str = strings.Join(lines, "\n")
+	return res
+}
+
+// redactClusterNodes replaces the addresses of the nodes of a CLUSTER NODES reply
+func redactClusterNodes(v CapturedValue) CapturedValue {
+	if v.Type != "bulk" {
+		return v
+	}
+	lines := strings.Split(v.Str, "\n")
+	for i, line := range lines {
+		fields := strings.Split(line, " ")
+		if len(fields) < 8 {
+			continue
+		}
+		fields[1] = redactedValue
+		lines[i] = strings.Join(fields, " ")
+	}
+	res := v
+	res.Str = strings.Join(lines, "\n")
+	return res
+}
+
+// redactedHost replaces the hosts in CLIENT LIST, the lines of the client list only parse with an address
+const redactedHost = "0.0.0.0"
+
+// redactClientList replaces the hosts of the addr and laddr fields of a CLIENT LIST reply, the ports are kept so the
+// client list metrics can still be exported from the bundle
+func redactClientList(v CapturedValue) CapturedValue {
+	if v.Type != "bulk" {
+		return v
+	}
+	lines := strings.Split(v.Str, "\n")
+	for i, line := range lines {
+		fields := strings.Split(line, " ")
+		for j, field := range fields {
+			key, addr, ok := strings.Cut(field, "=")
+			if !ok || (key != "addr" && key != "laddr") {
+				continue
+			}
+			port := ""
+			if idx := strings.LastIndexByte(addr, ':'); idx >= 0 {
+				port = addr[idx:]
+			}
+			fields[j] = key + "=" + redactedHost + port
+		}
+		lines[i] = strings.Join(fields, " ")
+	}
+	res := v
+	res.Str = strings.Join(lines, "\n")
+	return res
+}
+
+func redactAddr(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || u.User == nil {
+		return addr
+	}
+	return u.Redacted()
+}
+
+func (e *Exporter) captureCommands() [][]interface{} {
+	return [][]interface{}{
+		{"PING"},
+		{e.options.ConfigCommandName, "GET", "*"},
+		{"INFO", "ALL"},
+		{"SLOWLOG", "LEN"},
+		{"SLOWLOG", "GET", "1"},
+		{"CLIENT", "LIST"},
+		{"CLUSTER", "INFO"},
+		{"CLUSTER", "NODES"},
+	}
+}
+
+// Capture records the replies of the Kvrocks instance to the commands the exporter runs.
+// Error replies are recorded as well, e.g. CLUSTER INFO of an instance without cluster mode.
+func (e *Exporter) Capture() (*CaptureBundle, error) {
+	c, err := e.connectToKvrocks()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	b := &CaptureBundle{
+		Version:    captureBundleVersion,
+		Addr:       redactAddr(e.kvrocksAddr),
+		CapturedAt: time.Now().UTC(),
+	}
+	for _, cmd := range e.captureCommands() {
+		reply, err := doRedisCmd(c, cmd[0].(string), cmd[1:]...)
+		if err != nil {
+			if _, ok := err.(redis.Error); !ok {
+				return nil, err
+			}
+			reply = err
+		}
+
+		val, err := captureValue(reply)
+		if err != nil {
+			return nil, err
+		}
+		switch key := commandKey(cmd[0].(string), cmd[1:]...); {
+		case strings.EqualFold(cmd[0].(string), e.options.ConfigCommandName):
+			val = redactConfig(val)
+		case key == "INFO ALL":
+			val = redactInfo(val)
+		case key == "CLIENT LIST":
+			val = redactClientList(val)
+		case key == "CLUSTER NODES":
+			val = redactClusterNodes(val)
+		}
+
+		r := CapturedReply{Reply: val}
+		for _, arg := range cmd {
+			r.Command = append(r.Command, fmt.Sprint(arg))
+		}
+		b.Replies = append(b.Replies, r)
+	}
+	return b, nil
+}
+
+// Write writes the bundle as JSON
+func (b *CaptureBundle) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// WriteFile writes the bundle as JSON to path, replacing the file atomically
+func (b *CaptureBundle) WriteFile(path string) error {
+	return writeFileAtomic(path, b.Write)
+}
+
+// LoadCaptureBundle reads a bundle written by the capture subcommand
+func LoadCaptureBundle(path string) (*CaptureBundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var b CaptureBundle
+	if err := json.NewDecoder(f).Decode(&b); err != nil {
+		return nil, fmt.Errorf("couldn't decode capture bundle %s, err: %s", path, err)
+	}
+	if b.Version != captureBundleVersion {
+		return nil, fmt.Errorf("unsupported capture bundle version %d in %s", b.Version, path)
+	}
+	return &b, nil
+}
+
+func commandKey(cmd string, args ...interface{}) string {
+	parts := []string{cmd}
+	for _, arg := range args {
+		parts = append(parts, fmt.Sprint(arg))
+	}
+	return strings.ToUpper(strings.Join(parts, " "))
+}
+
+// replayConn is a redis.Conn that answers with the replies of a capture bundle
+type replayConn struct {
+	replies map[string]CapturedValue
+}
+
+func newReplayConn(b *CaptureBundle) *replayConn {
+	c := &replayConn{replies: map[string]CapturedValue{}}
+	for _, r := range b.Replies {
+		if len(r.Command) == 0 {
+			continue
+		}
+		args := make([]interface{}, 0, len(r.Command)-1)
+		for _, arg := range r.Command[1:] {
+			args = append(args, arg)
+		}
+		c.replies[commandKey(r.Command[0], args...)] = r.Reply
+	}
+	return c
+}
+
+var errReplayPipeline = errors.New("pipelining isn't supported when replaying a capture bundle")
+
+func (c *replayConn) Close() error { return nil }
+
+func (c *replayConn) Err() error { return nil }
+
+func (c *replayConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	key := commandKey(cmd, args...)
+	if r, ok := c.replies[key]; ok {
+		return r.value()
+	}
+	// setting the client name doesn't change what the server reports
+	if strings.HasPrefix(key, "CLIENT SETNAME ") {
+		return "OK", nil
+	}
+	log.Debugf("replay: %s isn't in the capture bundle", key)
+	return nil, redis.Error(fmt.Sprintf("ERR %s isn't in the capture bundle", key))
+}
+
+func (c *replayConn) Send(cmd string, args ...interface{}) error { return errReplayPipeline }
+
+func (c *replayConn) Flush() error { return errReplayPipeline }
+
+func (c *replayConn) Receive() (interface{}, error) { return nil, errReplayPipeline }
+
+// DoWithTimeout replies right away, the timeout is of no use for recorded replies
+func (c *replayConn) DoWithTimeout(_ time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return c.Do(cmd, args...)
+}
+
+func (c *replayConn) ReceiveWithTimeout(time.Duration) (interface{}, error) {
+	return nil, errReplayPipeline
+}
@@ -0,0 +1,212 @@
+package exporter
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/RocksLabs/kvrocks_exporter/info"
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCapturedValueRoundTrip(t *testing.T) {
+	for _, in := range []interface{}{
+		nil,
+		[]byte("# Server\r\nkvrocks_version:2.10.1\r\n"),
+		"PONG",
+		int64(42),
+		[]interface{}{int64(1), int64(1700000000), int64(12000), []interface{}{[]byte("GET"), []byte("foo")}},
+		[]interface{}{},
+		[]interface{}{redis.Error("ERR nested")},
+	} {
+		val, err := captureValue(in)
+		if err != nil {
+			t.Fatalf("captureValue(%#v) err: %s", in, err)
+		}
+		out, err := val.value()
+		if err != nil {
+			t.Fatalf("value() of %#v err: %s", in, err)
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("round trip of %#v got: %#v", in, out)
+		}
+	}
+
+	val, _ := captureValue(redis.Error("ERR This instance has cluster support disabled"))
+	if _, err := val.value(); err != redis.Error("ERR This instance has cluster support disabled") {
+		t.Errorf("want the error reply back, got: %v", err)
+	}
+}
+
+func TestRedactConfig(t *testing.T) {
+	in, _ := captureValue([]interface{}{
+		[]byte("maxclients"), []byte("10000"),
+		[]byte("requirepass"), []byte("foobared"),
+		[]byte("masterauth"), []byte(""),
+		[]byte("namespace.ns1"), []byte("token1"),
+	})
+	out := redactConfig(in)
+
+	want := []string{"maxclients", "10000", "requirepass", redactedValue, "masterauth", "", "namespace.ns1", redactedValue}
+	for i, v := range out.Array {
+		if v.Str != want[i] {
+			t.Errorf("config %d got: %q, want: %q", i, v.Str, want[i])
+		}
+	}
+	if in.Array[3].Str != "foobared" {
+		t.Errorf("redactConfig() must not modify its input")
+	}
+
+	if got := redactAddr("redis://:foobared@localhost:6666"); strings.Contains(got, "foobared") {
+		t.Errorf("redactAddr() kept the password: %s", got)
+	}
+	if got := redactAddr("localhost:6666"); got != "localhost:6666" {
+		t.Errorf("redactAddr() got: %s", got)
+	}
+}
+
+func TestRedactInfoAndClusterNodes(t *testing.T) {
+	in, _ := captureValue([]byte("# Server\r\nexecutable:/opt/kvrocks/bin/kvrocks\r\nconfig_file:/etc/kvrocks.conf\r\ntcp_port:6666\r\n" +
+		"# Replication\r\nrole:slave\r\nmaster_host:10.0.0.1\r\nmaster_port:6666\r\nslave0:ip=10.0.0.12,port=6666,offset=42,lag=0\r\n"))
+	out := redactInfo(in).Str
+	for _, secret := range []string{"/opt/kvrocks", "/etc/kvrocks.conf", "10.0.0.1", "10.0.0.12"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("redactInfo() kept %q: %s", secret, out)
+		}
+	}
+	snap := info.Parse(out)
+	if snap.Value("tcp_port") != "6666" || snap.Value("master_port") != "6666" || snap.Value("master_host") != redactedValue {
+		t.Errorf("redactInfo() changed other fields: %s", out)
+	}
+	if len(snap.Replication.Replicas) != 1 || snap.Replication.Replicas[0].Offset != 42 {
+		t.Errorf("redactInfo() broke the replica field: %s", out)
+	}
+
+	in, _ = captureValue([]byte("e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 10.0.0.1:30001@31001 myself,master - 0 0 1 connected 0-5460\n"))
+	out = redactClusterNodes(in).Str
+	nodes := parseClusterNodes(out)
+	if strings.Contains(out, "10.0.0.1") || len(nodes) != 1 || nodes[0].id != "e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca" || len(nodes[0].slots) != 1 {
+		t.Errorf("redactClusterNodes() got: %s", out)
+	}
+
+	in, _ = captureValue([]byte("id=11 addr=10.0.0.5:63508 laddr=10.0.0.1:6666 fd=8 name=worker age=6321 idle=6320 flags=N db=0 omem=0 cmd=setex\n" +
+		"id=14 addr=[::1]:64958 laddr=[::1]:6666 fd=9 name= age=5 idle=0 flags=N db=0 omem=0 cmd=client\n"))
+	out = redactClientList(in).Str
+	for _, secret := range []string{"10.0.0.5", "10.0.0.1", "::1"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("redactClientList() kept %q: %s", secret, out)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		client, ok := parseClientListString(line)
+		if !ok || client[len(client)-2] != redactedHost {
+			t.Errorf("redactClientList() broke the client line: %s", line)
+		}
+	}
+}
+
+func testCaptureBundle(t *testing.T) *CaptureBundle {
+	reply := func(cmd []string, v interface{}) CapturedReply {
+		val, err := captureValue(v)
+		if err != nil {
+			t.Fatalf("captureValue() err: %s", err)
+		}
+		return CapturedReply{Command: cmd, Reply: val}
+	}
+	return &CaptureBundle{
+		Version: captureBundleVersion,
+		Addr:    "localhost:6666",
+		Replies: []CapturedReply{
+			reply([]string{"PING"}, "PONG"),
+			reply([]string{"CONFIG", "GET", "*"}, []interface{}{[]byte("maxclients"), []byte("10000")}),
+			reply([]string{"INFO", "ALL"}, []byte(loadTestInfo(t))),
+			reply([]string{"SLOWLOG", "LEN"}, int64(7)),
+			reply([]string{"SLOWLOG", "GET", "1"}, []interface{}{[]interface{}{int64(6), int64(1700000000), int64(25000)}}),
+			reply([]string{"CLUSTER", "INFO"}, redis.Error("ERR This instance has cluster support disabled")),
+		},
+	}
+}
+
+func TestReplayBundle(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testCaptureBundle(t).Write(&buf); err != nil {
+		t.Fatalf("Write() err: %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "bundle.json")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("couldn't write bundle: %s", err)
+	}
+
+	b, err := LoadCaptureBundle(path)
+	if err != nil {
+		t.Fatalf("LoadCaptureBundle() err: %s", err)
+	}
+
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", ReplayBundle: b, SetClientName: true, Registry: prometheus.NewRegistry()})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/metrics")
+	for _, want := range []string{
+		`test_up 1`,
+		`test_config_maxclients 10000`,
+		`test_instance_info{`,
+		`test_commands_total{cmd="get"}`,
+		`test_slowlog_length 7`,
+		`test_slowlog_last_id 6`,
+		`test_last_slow_execution_duration_seconds 0.025`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+}
+
+func TestLoadCaptureBundleErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"broken.json":  `{"version":`,
+		"version.json": `{"version":99}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("couldn't write bundle: %s", err)
+		}
+		if _, err := LoadCaptureBundle(path); err == nil {
+			t.Errorf("expected error for %s", name)
+		}
+	}
+	if _, err := LoadCaptureBundle(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("expected error for missing bundle")
+	}
+}
+
+func TestCapture(t *testing.T) {
+	addr := os.Getenv("TEST_REDIS_URI")
+	if addr == "" {
+		t.Skipf("TEST_REDIS_URI not set - skipping")
+	}
+
+	e, _ := NewKvrocksExporter(addr, Options{Namespace: "test", Registry: prometheus.NewRegistry()})
+	b, err := e.Capture()
+	if err != nil {
+		t.Fatalf("Capture() err: %s", err)
+	}
+	if len(b.Replies) != len(e.captureCommands()) {
+		t.Errorf("want a reply for each command, got: %d", len(b.Replies))
+	}
+
+	// the capture replays to the same metrics
+	e, _ = NewKvrocksExporter(addr, Options{Namespace: "test", ReplayBundle: b, Registry: prometheus.NewRegistry()})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	if body := downloadURL(t, ts.URL+"/metrics"); !strings.Contains(body, "test_up 1") {
+		t.Errorf("want metrics to include test_up 1, have:\n%s", body)
+	}
+}
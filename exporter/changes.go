@@ -0,0 +1,269 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RocksLabs/kvrocks_exporter/info"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const changeStateVersion = 1
+
+// start times moving less than this are jitter of the uptime, not a restart
+const restartStartTimeSlack = 5.0
+
+// instanceState is what the exporter remembers of an instance between scrapes
+type instanceState struct {
+	// RunID is the run_id of INFO, or the process_id for servers without run_id
+	RunID     string  `json:"run_id"`
+	StartTime float64 `json:"start_time"`
+	Role      string  `json:"role"`
+	// Master is the host:port of the master of a replica
+	Master           string  `json:"master,omitempty"`
+	MasterLinkStatus string  `json:"master_link_status,omitempty"`
+	Loading          string  `json:"loading,omitempty"`
+	BackgroundErrors float64 `json:"background_errors"`
+
+	Restarts      float64                       `json:"restarts"`
+	RoleChanges   map[string]map[string]float64 `json:"role_changes,omitempty"` // by from and to role
+	MasterChanges float64                       `json:"master_changes"`
+
+	LastRestart      float64 `json:"last_restart,omitempty"`
+	LastRoleChange   float64 `json:"last_role_change,omitempty"`
+	LastMasterChange float64 `json:"last_master_change,omitempty"`
+}
+
+type changeState struct {
+	Version   int                       `json:"version"`
+	Instances map[string]*instanceState `json:"instances"`
+	Backups   map[string]*backupState   `json:"backups,omitempty"`
+}
+
+/*
+changeTracker remembers the identity, role and master of the instances across scrapes to count restarts,
+role changes and master changes, and their last successful backup. It's shared by an exporter and the exporters
+of its targets, and is kept in Options.StateFile so the counters survive restarts of the exporter.
+*/
+type changeTracker struct {
+	sync.Mutex
+	path      string
+	instances map[string]*instanceState
+	backups   map[string]*backupState
+
+	// write stall counters of the last scrape by instance, not kept in the state file
+	writeStalls map[string]map[string]float64
+	// slot migrations of the instances, not kept in the state file
+	slotMigrations map[string]*slotMigrationState
+}
+
+func newChangeTracker(path string) (*changeTracker, error) {
+	t := &changeTracker{
+		path:        path,
+		instances:   map[string]*instanceState{},
+		backups:     map[string]*backupState{},
+		writeStalls: map[string]map[string]float64{},
+
+		slotMigrations: map[string]*slotMigrationState{},
+	}
+	if path == "" {
+		return t, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st changeState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, fmt.Errorf("couldn't decode state file %s, err: %s", path, err)
+	}
+	if st.Version != changeStateVersion {
+		return nil, fmt.Errorf("unsupported state file version %d in %s", st.Version, path)
+	}
+	if st.Instances != nil {
+		t.instances = st.Instances
+	}
+	if st.Backups != nil {
+		t.backups = st.Backups
+	}
+	return t, nil
+}
+
+// instanceStateOf returns the identity, role and master of the instance INFO was returned by
+func instanceStateOf(snap *info.Snapshot, now time.Time) instanceState {
+	cur := instanceState{RunID: snap.Value("run_id"), Role: snap.Replication.Role}
+	if cur.RunID == "" {
+		cur.RunID = snap.Server.ProcessID
+	}
+
+	cur.StartTime = serverTime(snap, now) - snap.Server.UptimeInSeconds
+
+	if cur.Role == "slave" && snap.Replication.MasterHost != "" {
+		cur.Master = net.JoinHostPort(snap.Replication.MasterHost, snap.Replication.MasterPort)
+		cur.MasterLinkStatus = snap.Replication.MasterLinkStatus
+	}
+	cur.Loading = snap.Value("loading")
+	cur.BackgroundErrors, _ = strconv.ParseFloat(snap.Value("num_background_errors"), 64)
+	return cur
+}
+
+// serverTime returns the clock of the instance in unix seconds, or now for servers without server_time_usec
+func serverTime(snap *info.Snapshot, now time.Time) float64 {
+	if usec, err := strconv.ParseFloat(snap.Value("server_time_usec"), 64); err == nil && usec > 0 {
+		return usec / 1e6
+	}
+	return float64(now.Unix())
+}
+
+/*
+observe compares cur with what was seen of the instance at addr before and returns its updated state and the
+events of the transitions. Nothing is counted for the first scrape of an instance. An instance restarted if its
+run id changed or it started later than before, e.g. a process with the pid 1 in a container.
+*/
+func (t *changeTracker) observe(addr string, cur instanceState, now time.Time) (instanceState, []Event) {
+	t.Lock()
+	defer t.Unlock()
+
+	prev := t.instances[addr]
+	if prev == nil {
+		st := cur
+		t.instances[addr] = &st
+		t.save()
+		return st, nil
+	}
+
+	var events []Event
+	event := func(typ, from, to string) {
+		events = append(events, Event{Type: typ, Instance: addr, Time: now, From: from, To: to})
+	}
+
+	ts := float64(now.Unix())
+	restarted := cur.RunID != prev.RunID || cur.StartTime > prev.StartTime+restartStartTimeSlack
+	if restarted {
+		prev.Restarts++
+		prev.LastRestart = ts
+		event(EventRestarted, prev.RunID, cur.RunID)
+	}
+	if cur.Role != prev.Role && cur.Role != "" && prev.Role != "" {
+		if prev.RoleChanges == nil {
+			prev.RoleChanges = map[string]map[string]float64{}
+		}
+		if prev.RoleChanges[prev.Role] == nil {
+			prev.RoleChanges[prev.Role] = map[string]float64{}
+		}
+		prev.RoleChanges[prev.Role][cur.Role]++
+		prev.LastRoleChange = ts
+		event(EventRoleChanged, prev.Role, cur.Role)
+	}
+	if cur.Master != prev.Master && cur.Master != "" && prev.Master != "" {
+		prev.MasterChanges++
+		prev.LastMasterChange = ts
+		event(EventMasterChanged, prev.Master, cur.Master)
+	}
+
+	// only replicas have a master link, a replica seen for the first time has no transition
+	if cur.Master != "" && prev.Master != "" && cur.MasterLinkStatus != prev.MasterLinkStatus {
+		switch {
+		case prev.MasterLinkStatus == "up":
+			event(EventMasterLinkDown, prev.MasterLinkStatus, cur.MasterLinkStatus)
+		case cur.MasterLinkStatus == "up":
+			event(EventMasterLinkUp, prev.MasterLinkStatus, cur.MasterLinkStatus)
+		}
+	}
+	if cur.Loading != prev.Loading && prev.Loading != "" {
+		switch cur.Loading {
+		case "1":
+			event(EventLoadingStarted, prev.Loading, cur.Loading)
+		case "0":
+			event(EventLoadingFinished, prev.Loading, cur.Loading)
+		}
+	}
+	// the errors are counted from 0 again after a restart
+	if cur.BackgroundErrors > prev.BackgroundErrors && !restarted {
+		event(EventBackgroundErrors, strconv.FormatFloat(prev.BackgroundErrors, 'f', -1, 64), strconv.FormatFloat(cur.BackgroundErrors, 'f', -1, 64))
+	}
+
+	// the start time is kept unless the instance restarted, so it can't drift by the jitter of the uptime
+	startTime := prev.StartTime
+	if restarted {
+		startTime = cur.StartTime
+	}
+	counters := *prev
+	counters.RunID, counters.StartTime, counters.Role, counters.Master = cur.RunID, startTime, cur.Role, cur.Master
+	counters.MasterLinkStatus, counters.Loading, counters.BackgroundErrors = cur.MasterLinkStatus, cur.Loading, cur.BackgroundErrors
+	if len(events) > 0 || !sameObservedState(*prev, counters) {
+		*prev = counters
+		t.save()
+	}
+
+	st := *prev
+	st.RoleChanges = map[string]map[string]float64{}
+	for from, tos := range prev.RoleChanges {
+		st.RoleChanges[from] = map[string]float64{}
+		for to, n := range tos {
+			st.RoleChanges[from][to] = n
+		}
+	}
+	return st, events
+}
+
+// sameObservedState returns whether a and b are the same instance in the same state, regardless of the counters
+func sameObservedState(a, b instanceState) bool {
+	return a.RunID == b.RunID && a.StartTime == b.StartTime && a.Role == b.Role && a.Master == b.Master &&
+		a.MasterLinkStatus == b.MasterLinkStatus && a.Loading == b.Loading && a.BackgroundErrors == b.BackgroundErrors
+}
+
+// save writes the state file, the caller holds the lock
+func (t *changeTracker) save() {
+	if t.path == "" {
+		return
+	}
+	err := writeFileAtomic(t.path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(changeState{Version: changeStateVersion, Instances: t.instances, Backups: t.backups})
+	})
+	if err != nil {
+		log.Errorf("Couldn't write state file %s, err: %s", t.path, err)
+	}
+}
+
+func (e *Exporter) extractInstanceChangeMetrics(ch chan<- prometheus.Metric, snap *info.Snapshot) {
+	now := time.Now()
+	st, events := e.changes.observe(targetLabel(e.kvrocksAddr), instanceStateOf(snap, now), now)
+	for _, ev := range events {
+		ev.Labels = e.options.ConstLabels
+		for _, n := range e.options.Notifiers {
+			n.Notify(ev)
+		}
+	}
+
+	e.registerConstMetric(ch, "restarts_detected_total", st.Restarts, prometheus.CounterValue)
+	e.registerConstMetric(ch, "master_changes_total", st.MasterChanges, prometheus.CounterValue)
+	for from, tos := range st.RoleChanges {
+		for to, n := range tos {
+			e.registerConstMetric(ch, "role_changes_total", n, prometheus.CounterValue, from, to)
+		}
+	}
+
+	if st.LastRestart > 0 {
+		e.registerConstMetricGauge(ch, "last_restart_timestamp_seconds", st.LastRestart)
+	}
+	if st.LastRoleChange > 0 {
+		e.registerConstMetricGauge(ch, "last_role_change_timestamp_seconds", st.LastRoleChange)
+	}
+	if st.LastMasterChange > 0 {
+		e.registerConstMetricGauge(ch, "last_master_change_timestamp_seconds", st.LastMasterChange)
+	}
+}
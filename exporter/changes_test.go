@@ -0,0 +1,125 @@
+package exporter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RocksLabs/kvrocks_exporter/info"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func metricValue(mfs map[string]*dto.MetricFamily, name string, labels map[string]string) (float64, bool) {
+	mf, ok := mfs[name]
+	if !ok {
+		return 0, false
+	}
+	for _, m := range mf.GetMetric() {
+		matches := true
+		for _, l := range m.GetLabel() {
+			if v, ok := labels[l.GetName()]; ok && v != l.GetValue() {
+				matches = false
+			}
+		}
+		if !matches {
+			continue
+		}
+		if m.GetCounter() != nil {
+			return m.GetCounter().GetValue(), true
+		}
+		return m.GetGauge().GetValue(), true
+	}
+	return 0, false
+}
+
+func TestInstanceChangeMetrics(t *testing.T) {
+	base := loadTestInfo(t)
+	replica := func(s, master string) string {
+		return strings.Replace(s, "role:master", "role:slave\r\nmaster_host:"+master+"\r\nmaster_port:6666", 1)
+	}
+	later := strings.NewReplacer("server_time_usec:1729245600123456", "server_time_usec:1729245615123456", "uptime_in_seconds:86412", "uptime_in_seconds:86427").Replace(base)
+	restarted := strings.NewReplacer("process_id:2041", "process_id:3301", "uptime_in_seconds:86412", "uptime_in_seconds:3").Replace(later)
+
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test"})
+	for _, step := range []struct {
+		info          string
+		restarts      float64
+		masterChanges float64
+		roleChanges   map[string]float64 // by from/to
+	}{
+		{info: base},
+		{info: later},
+		{info: replica(later, "10.0.0.1"), roleChanges: map[string]float64{"master/slave": 1}},
+		{info: replica(later, "10.0.0.2"), masterChanges: 1, roleChanges: map[string]float64{"master/slave": 1}},
+		{info: replica(restarted, "10.0.0.2"), restarts: 1, masterChanges: 1, roleChanges: map[string]float64{"master/slave": 1}},
+		{info: restarted, restarts: 1, masterChanges: 1, roleChanges: map[string]float64{"master/slave": 1, "slave/master": 1}},
+	} {
+		mfs := gatherInfoMetrics(t, e, step.info)
+		if got, _ := metricValue(mfs, "test_restarts_detected_total", nil); got != step.restarts {
+			t.Errorf("restarts_detected_total got: %v, want: %v", got, step.restarts)
+		}
+		if got, _ := metricValue(mfs, "test_master_changes_total", nil); got != step.masterChanges {
+			t.Errorf("master_changes_total got: %v, want: %v", got, step.masterChanges)
+		}
+		for fromTo, want := range step.roleChanges {
+			from, to, _ := strings.Cut(fromTo, "/")
+			if got, _ := metricValue(mfs, "test_role_changes_total", map[string]string{"from": from, "to": to}); got != want {
+				t.Errorf("role_changes_total{from=%s,to=%s} got: %v, want: %v", from, to, got, want)
+			}
+		}
+		if _, ok := metricValue(mfs, "test_last_restart_timestamp_seconds", nil); ok != (step.restarts > 0) {
+			t.Errorf("last_restart_timestamp_seconds exported: %v, want: %v", ok, step.restarts > 0)
+		}
+		if _, ok := metricValue(mfs, "test_last_master_change_timestamp_seconds", nil); ok != (step.masterChanges > 0) {
+			t.Errorf("last_master_change_timestamp_seconds exported: %v, want: %v", ok, step.masterChanges > 0)
+		}
+	}
+}
+
+func TestChangeTrackerStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	now := time.Unix(1729245600, 0)
+
+	tr, err := newChangeTracker(path)
+	if err != nil {
+		t.Fatalf("newChangeTracker() err: %s", err)
+	}
+	_, _ = tr.observe("node-1:6666", instanceState{RunID: "a", StartTime: 1000, Role: "master"}, now)
+	_, _ = tr.observe("node-1:6666", instanceState{RunID: "b", StartTime: 2000, Role: "master"}, now)
+
+	// the restart of the exporter keeps the counters, and a restart while it was down is counted
+	tr, err = newChangeTracker(path)
+	if err != nil {
+		t.Fatalf("newChangeTracker() err: %s", err)
+	}
+	st, _ := tr.observe("node-1:6666", instanceState{RunID: "c", StartTime: 3000, Role: "master"}, now)
+	if st.Restarts != 2 || st.LastRestart != float64(now.Unix()) {
+		t.Errorf("observe() got restarts: %v at %v, want: 2 at %v", st.Restarts, st.LastRestart, now.Unix())
+	}
+
+	// a start time moving by the jitter of the uptime isn't a restart
+	st, _ = tr.observe("node-1:6666", instanceState{RunID: "c", StartTime: 3001, Role: "master"}, now)
+	if st.Restarts != 2 {
+		t.Errorf("observe() got restarts: %v, want: 2", st.Restarts)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version": 2}`), 0o600); err != nil {
+		t.Fatalf("couldn't write state file: %s", err)
+	}
+	if _, err := newChangeTracker(path); err == nil {
+		t.Errorf("expected error for an unsupported state file version")
+	}
+	if _, err := NewKvrocksExporter("localhost:6666", Options{StateFile: path}); err == nil {
+		t.Errorf("expected error for an invalid state file")
+	}
+}
+
+func TestInstanceStateOf(t *testing.T) {
+	snap := info.Parse(loadTestInfo(t))
+	st := instanceStateOf(snap, time.Now())
+	if st.RunID != "2041" || st.StartTime != 1729245600.123456-86412 || st.Role != "master" || st.Master != "" {
+		t.Errorf("instanceStateOf() got: %+v", st)
+	}
+}
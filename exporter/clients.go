@@ -1,7 +1,6 @@
 package exporter
 
 import (
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -15,51 +14,98 @@ import (
 	id=14 addr=127.0.0.1:64958 fd=9 name= age=5 idle=0 flags=N db=0 sub=0 psub=0 multi=-1 qbuf=26 qbuf-free=32742 obl=0 oll=0 omem=0 events=r cmd=client
 */
 func parseClientListString(clientInfo string) ([]string, bool) {
-	if matched, _ := regexp.MatchString(`^id=\d+ addr=\d+`, clientInfo); !matched {
+	if !isClientListLine(clientInfo) {
 		return nil, false
 	}
-	connectedClient := map[string]string{}
-	for _, kvPart := range strings.Split(clientInfo, " ") {
-		vPart := strings.Split(kvPart, "=")
-		if len(vPart) != 2 {
+
+	var name, age, idle, flags, db, omem, cmd, addr string
+	for rest := clientInfo; rest != ""; {
+		kvPart := rest
+		if idx := strings.IndexByte(rest, ' '); idx >= 0 {
+			kvPart, rest = rest[:idx], rest[idx+1:]
+		} else {
+			rest = ""
+		}
+		k, v, ok := strings.Cut(kvPart, "=")
+		if !ok || strings.IndexByte(v, '=') >= 0 {
 			log.Debugf("Invalid format for client list string, got: %s", kvPart)
 			return nil, false
 		}
-		connectedClient[vPart[0]] = vPart[1]
+		switch k {
+		case "name":
+			name = v
+		case "age":
+			age = v
+		case "idle":
+			idle = v
+		case "flags":
+			flags = v
+		case "db":
+			db = v
+		case "omem":
+			omem = v
+		case "cmd":
+			cmd = v
+		case "addr":
+			addr = v
+		}
 	}
 
-	createdAtTs, err := durationFieldToTimestamp(connectedClient["age"])
+	createdAtTs, err := durationFieldToTimestamp(age)
 	if err != nil {
-		log.Debugf("cloud not parse age field(%s): %s", connectedClient["age"], err.Error())
+		log.Debugf("cloud not parse age field(%s): %s", age, err.Error())
 		return nil, false
 	}
 
-	idleSinceTs, err := durationFieldToTimestamp(connectedClient["idle"])
+	idleSinceTs, err := durationFieldToTimestamp(idle)
 	if err != nil {
-		log.Debugf("cloud not parse idle field(%s): %s", connectedClient["idle"], err.Error())
+		log.Debugf("cloud not parse idle field(%s): %s", idle, err.Error())
 		return nil, false
 	}
 
-	hostPortString := strings.Split(connectedClient["addr"], ":")
-	if len(hostPortString) != 2 {
+	host, port, ok := strings.Cut(addr, ":")
+	if !ok || strings.IndexByte(port, ':') >= 0 {
 		return nil, false
 	}
 
 	return []string{
-		connectedClient["name"],
+		name,
 		createdAtTs,
 		idleSinceTs,
-		connectedClient["flags"],
-		connectedClient["db"],
-		connectedClient["omem"],
-		connectedClient["cmd"],
+		flags,
+		db,
+		omem,
+		cmd,
 
-		hostPortString[0], // host
-		hostPortString[1], // port
+		host,
+		port,
 	}, true
 
 }
 
+// isClientListLine matches `^id=\d+ addr=\d+` without the cost of a regex
+func isClientListLine(s string) bool {
+	s, ok := cutNumberPrefix(s, "id=")
+	if !ok {
+		return false
+	}
+	_, ok = cutNumberPrefix(s, " addr=")
+	return ok
+}
+
+// cutNumberPrefix cuts prefix and the digits following it off s, ok is false if there are no digits
+func cutNumberPrefix(s, prefix string) (rest string, ok bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	s = s[len(prefix):]
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[i:], i > 0
+}
+
 func durationFieldToTimestamp(field string) (string, error) {
 	parsed, err := strconv.ParseInt(field, 10, 64)
 	if err != nil {
@@ -1,7 +1,9 @@
 package exporter
 
 import (
+	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -100,3 +102,40 @@ func TestParseClientListString(t *testing.T) {
 		}
 	}
 }
+
+func BenchmarkParseClientListString(b *testing.B) {
+	buf, err := os.ReadFile("testdata/client-list.txt")
+	if err != nil {
+		b.Fatalf("couldn't read testdata: %s", err)
+	}
+	clients := strings.Split(strings.TrimSpace(string(buf)), "\n")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, c := range clients {
+			if _, ok := parseClientListString(c); !ok {
+				b.Fatalf("couldn't parse %q", c)
+			}
+		}
+	}
+}
+
+func TestIsClientListLine(t *testing.T) {
+	for _, tst := range []struct {
+		in   string
+		want bool
+	}{
+		{in: "id=11 addr=127.0.0.1:63508 fd=8", want: true},
+		{in: "id=11 addr=1", want: true},
+		{in: "id= addr=127.0.0.1:63508", want: false},
+		{in: "id=11 addr=host:63508", want: false},
+		{in: "id=11  addr=127.0.0.1:63508", want: false},
+		{in: "addr=127.0.0.1:63508 id=11", want: false},
+		{in: "", want: false},
+	} {
+		if got := isClientListLine(tst.in); got != tst.want {
+			t.Errorf("isClientListLine(%q) got: %t, want: %t", tst.in, got, tst.want)
+		}
+	}
+}
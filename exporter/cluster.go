@@ -0,0 +1,191 @@
+package exporter
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var slotMigrationStates = []string{"none", "start", "success", "fail"}
+
+type clusterNode struct {
+	id     string
+	addr   string
+	flags  []string
+	master string
+	link   string
+	slots  []string
+}
+
+func (n clusterNode) hasFlag(flag string) bool {
+	for _, f := range n.flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+valid examples:
+  - 07c37dfeb235213a872192d90877d0cd55635b91 127.0.0.1:30004@31004 slave e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 0 1426238317239 4 connected
+  - 67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1 127.0.0.1:30002 master - 0 1426238316232 2 connected 5461-10922
+  - e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:30001 myself,master - 0 0 1 connected 0-5460
+*/
+func parseClusterNodes(nodes string) []clusterNode {
+	var res []clusterNode
+	for _, line := range strings.Split(nodes, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		res = append(res, clusterNode{
+			id:     fields[0],
+			addr:   strings.SplitN(fields[1], "@", 2)[0],
+			flags:  strings.Split(fields[2], ","),
+			master: fields[3],
+			link:   fields[7],
+			slots:  fields[8:],
+		})
+	}
+	return res
+}
+
+type slotMigration struct {
+	slot        string
+	destination string
+	state       string
+}
+
+/*
+Kvrocks appends the state of the current slot migration to CLUSTER INFO:
+
+	migrating_slot: 23
+	destination_node: 3e0ae1ebdbb2aa9e9ad5e8b9e2e4f5b0e0f3b9a4
+	migrating_state: start
+
+newer versions migrate slot ranges and report them as "migrating_slot(s): 23-42"
+*/
+func parseClusterInfo(info string) (fields map[string]string, migration slotMigration, ok bool) {
+	fields = map[string]string{}
+	for _, line := range strings.Split(info, "\n") {
+		idx := strings.IndexByte(line, ':')
+		if idx < 0 {
+			continue
+		}
+		fields[strings.TrimSpace(line[:idx])] = strings.TrimSpace(line[idx+1:])
+	}
+
+	migration.slot = fields["migrating_slot"]
+	if s, exists := fields["migrating_slot(s)"]; exists {
+		migration.slot = s
+	}
+	migration.destination = fields["destination_node"]
+	migration.state = fields["migrating_state"]
+
+	ok = migration.slot != "" && migration.slot != "-1" && migration.state != ""
+	return
+}
+
+func (e *Exporter) extractClusterInfoMetrics(ch chan<- prometheus.Metric, c redis.Conn) {
+	clusterInfo, err := redis.String(doRedisCmd(c, "CLUSTER", "INFO"))
+	if err != nil {
+		log.Errorf("Kvrocks CLUSTER INFO err: %s", err)
+		return
+	}
+	log.Debugf("Kvrocks CLUSTER INFO result: [%#v]", clusterInfo)
+
+	fields, migration, ok := parseClusterInfo(clusterInfo)
+	for k, v := range fields {
+		if strings.HasPrefix(k, "cluster_") && e.includeMetric(k) {
+			e.parseAndRegisterConstMetric(ch, k, v)
+		}
+	}
+
+	if !ok {
+		// servers that can migrate slots report migrating_slot -1 with the state none while idle
+		if _, reported := fields["migrating_state"]; reported {
+			e.registerSlotMigrationMetrics(ch, "none", nil)
+		} else {
+			e.changes.observeSlotMigration(targetLabel(e.kvrocksAddr), nil)
+		}
+		return
+	}
+
+	sourceNode := ""
+	if nodes, err := redis.String(doRedisCmd(c, "CLUSTER", "NODES")); err == nil {
+		for _, n := range parseClusterNodes(nodes) {
+			if n.hasFlag("myself") {
+				sourceNode = n.id
+				break
+			}
+		}
+	} else {
+		log.Debugf("Kvrocks CLUSTER NODES err: %s", err)
+	}
+
+	// ranges are reported by their first slot
+	if slot, err := strconv.ParseFloat(strings.SplitN(migration.slot, "-", 2)[0], 64); err == nil {
+		e.registerConstMetricGauge(ch, "cluster_migrating_slot", slot, sourceNode, migration.destination)
+	}
+	e.registerSlotMigrationMetrics(ch, migration.state, &migration)
+}
+
+// registerSlotMigrationMetrics exports the state of the current slot migration m, nil if the node isn't migrating
+// a slot, and the counts of the finished ones
+func (e *Exporter) registerSlotMigrationMetrics(ch chan<- prometheus.Metric, state string, m *slotMigration) {
+	for _, s := range slotMigrationStates {
+		val := 0.0
+		if s == state {
+			val = 1
+		}
+		e.registerConstMetricGauge(ch, "cluster_migrating_state", val, s)
+	}
+
+	finished := e.changes.observeSlotMigration(targetLabel(e.kvrocksAddr), m)
+	for _, result := range []string{"success", "fail"} {
+		e.registerConstMetric(ch, "cluster_slot_migrations_total", finished[result], prometheus.CounterValue, result)
+	}
+}
+
+// slotMigrationState is what the exporter remembers of the slot migrations of an instance between scrapes
+type slotMigrationState struct {
+	// last migration seen in CLUSTER INFO, "" if none
+	last string
+	// finished migrations by result
+	finished map[string]float64
+}
+
+// observeSlotMigration counts the finished migrations of the instance at addr and returns the counts by result.
+// Kvrocks keeps reporting the last migration after it finished, so each one is only counted once, and not at all
+// if it already finished before the first scrape.
+func (t *changeTracker) observeSlotMigration(addr string, m *slotMigration) map[string]float64 {
+	t.Lock()
+	defer t.Unlock()
+
+	key := ""
+	if m != nil {
+		key = m.slot + "/" + m.destination + "/" + m.state
+	}
+	st := t.slotMigrations[addr]
+	if st == nil {
+		st = &slotMigrationState{last: key, finished: map[string]float64{}}
+		t.slotMigrations[addr] = st
+	}
+	if key != st.last && m != nil {
+		switch m.state {
+		case "success", "fail":
+			st.finished[m.state]++
+		}
+	}
+	st.last = key
+
+	res := map[string]float64{}
+	for result, n := range st.finished {
+		res[result] = n
+	}
+	return res
+}
@@ -0,0 +1,125 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestParseClusterNodes(t *testing.T) {
+	nodes := parseClusterNodes(`07c37dfeb235213a872192d90877d0cd55635b91 127.0.0.1:30004@31004 slave e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 0 1426238317239 4 connected
+67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1 127.0.0.1:30002 master - 0 1426238316232 2 connected 5461-10922
+e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:30001 myself,master - 0 0 1 connected 0-5460 16383
+broken line
+`)
+
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 nodes, got: %#v", nodes)
+	}
+	if nodes[0].addr != "127.0.0.1:30004" || nodes[0].master != "e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca" || !nodes[0].hasFlag("slave") {
+		t.Errorf("unexpected node: %#v", nodes[0])
+	}
+	if !nodes[2].hasFlag("myself") || nodes[2].link != "connected" || len(nodes[2].slots) != 2 {
+		t.Errorf("unexpected node: %#v", nodes[2])
+	}
+}
+
+func TestParseClusterInfo(t *testing.T) {
+	for _, tst := range []struct {
+		name   string
+		info   string
+		wantOk bool
+		want   slotMigration
+	}{
+		{
+			name:   "migrating",
+			info:   "cluster_state:ok\r\ncluster_slots_assigned:16384\r\nmigrating_slot: 23\r\ndestination_node: abc\r\nmigrating_state: start\r\n",
+			wantOk: true,
+			want:   slotMigration{slot: "23", destination: "abc", state: "start"},
+		},
+		{
+			name:   "migrating-range",
+			info:   "cluster_state:ok\r\nmigrating_slot(s): 23-42\r\ndestination_node: abc\r\nmigrating_state: success\r\n",
+			wantOk: true,
+			want:   slotMigration{slot: "23-42", destination: "abc", state: "success"},
+		},
+		{
+			name: "not-migrating",
+			info: "cluster_state:ok\r\ncluster_slots_assigned:16384\r\n",
+		},
+		{
+			name: "no-slot",
+			info: "cluster_state:ok\r\nmigrating_slot: -1\r\ndestination_node: \r\nmigrating_state: none\r\n",
+		},
+	} {
+		t.Run(tst.name, func(t *testing.T) {
+			fields, migration, ok := parseClusterInfo(tst.info)
+			if fields["cluster_state"] != "ok" {
+				t.Errorf("expected cluster_state field, got: %#v", fields)
+			}
+			if ok != tst.wantOk {
+				t.Fatalf("got ok: %t, wanted: %t", ok, tst.wantOk)
+			}
+			if ok && migration != tst.want {
+				t.Errorf("got: %#v, wanted: %#v", migration, tst.want)
+			}
+		})
+	}
+}
+
+func TestObserveSlotMigration(t *testing.T) {
+	e, _ := NewKvrocksExporter("", Options{Namespace: "test"})
+
+	var finished map[string]float64
+	for _, m := range []*slotMigration{
+		// finished before the first scrape, not counted
+		{slot: "1", destination: "abc", state: "success"},
+		{slot: "1", destination: "abc", state: "success"},
+		{slot: "2", destination: "abc", state: "start"},
+		{slot: "2", destination: "abc", state: "success"},
+		{slot: "2", destination: "abc", state: "success"},
+		nil,
+		{slot: "3", destination: "abc", state: "fail"},
+	} {
+		finished = e.changes.observeSlotMigration("node-1:6666", m)
+	}
+
+	if got := finished["success"]; got != 1 {
+		t.Errorf("got %f successful migrations, wanted 1", got)
+	}
+	if got := finished["fail"]; got != 1 {
+		t.Errorf("got %f failed migrations, wanted 1", got)
+	}
+
+	// the counts are kept by instance, e.g. for the short-lived exporters of /scrape_cluster
+	child, _ := e.newChildExporter("redis://node-1:6666", e.options)
+	if got := child.changes.observeSlotMigration("node-1:6666", nil); got["success"] != 1 {
+		t.Errorf("got %v migrations for a new exporter of the node, wanted the ones seen before", got)
+	}
+	if got := e.changes.observeSlotMigration("node-2:6666", nil); len(got) != 0 {
+		t.Errorf("got %v migrations for another node, wanted none", got)
+	}
+}
+
+func TestSlotMigrationIdleState(t *testing.T) {
+	e, _ := NewKvrocksExporter("", Options{Namespace: "test"})
+	ch := make(chan prometheus.Metric, 10)
+	e.registerSlotMigrationMetrics(ch, "none", nil)
+	close(ch)
+
+	var states []string
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatalf("Write() err: %s", err)
+		}
+		if strings.Contains(m.Desc().String(), "cluster_migrating_state") && pb.GetGauge().GetValue() == 1 {
+			states = append(states, pb.GetLabel()[0].GetValue())
+		}
+	}
+	if len(states) != 1 || states[0] != "none" {
+		t.Errorf("got active states %v, wanted [none]", states)
+	}
+}
@@ -0,0 +1,46 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Config is the content of the config file of the exporter, e.g.
+//
+//	{
+//	  "targets": ["kvrocks://node-1:6666", "kvrocks://node-2:6666"],
+//	  "commands": [{"name": "delayed_jobs", "command": ["ZCARD", "delayed_jobs"]}]
+//	}
+type Config struct {
+	// Targets are scraped on /metrics together with the addresses of --kvrocks.addr
+	Targets []string `json:"targets"`
+
+	// Commands are run on every scrape, see CommandConfig
+	Commands []CommandConfig `json:"commands"`
+}
+
+// LoadConfigFile reads the config file of the exporter, unknown fields and commands that aren't read-only are an error
+func LoadConfigFile(path string) (*Config, error) {
+	log.Debugf("start load config file: %s", path)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	for i := range cfg.Commands {
+		if _, err := cfg.Commands[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	log.Debugf("Loaded %d targets and %d commands from %s", len(cfg.Targets), len(cfg.Commands), path)
+	return &cfg, nil
+}
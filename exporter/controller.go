@@ -0,0 +1,254 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+type controllerNode struct {
+	ID   string `json:"id"`
+	Addr string `json:"addr"`
+	Role string `json:"role"`
+}
+
+type controllerShard struct {
+	Nodes            []controllerNode `json:"nodes"`
+	SlotRanges       []string         `json:"slot_ranges"`
+	ImportSlot       int              `json:"import_slot"`
+	MigratingSlot    int              `json:"migrating_slot"`
+	TargetShardIndex int              `json:"target_shard_index"`
+}
+
+// UnmarshalJSON defaults the slot fields to -1 ("none") when the controller omits them
+func (s *controllerShard) UnmarshalJSON(b []byte) error {
+	type shard controllerShard
+	res := shard{ImportSlot: -1, MigratingSlot: -1, TargetShardIndex: -1}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return err
+	}
+	*s = controllerShard(res)
+	return nil
+}
+
+type controllerCluster struct {
+	Name    string            `json:"name"`
+	Version int64             `json:"version"`
+	Shards  []controllerShard `json:"shards"`
+}
+
+// controllerClient talks to the HTTP API of a kvrocks-controller
+type controllerClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func (e *Exporter) newControllerClient(addr string) *controllerClient {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	timeout := e.options.ConnectionTimeouts
+	if timeout == 0 {
+		timeout = 15 * time.Second
+	}
+	return &controllerClient{
+		baseURL: strings.TrimRight(addr, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+/*
+All controller responses are wrapped like this:
+
+	{"data": {...}}
+	{"error": {"message": "..."}}
+*/
+func (c *controllerClient) get(path string, data interface{}) error {
+	u := c.baseURL + path
+	log.Debugf("controller GET %s", u)
+
+	resp, err := c.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Data  json.RawMessage `json:"data"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("couldn't decode controller response for %s, status: %d, err: %s", path, resp.StatusCode, err)
+	}
+	if res.Error != nil && res.Error.Message != "" {
+		return fmt.Errorf("controller error for %s: %s", path, res.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("controller returned status %d for %s", resp.StatusCode, path)
+	}
+	return json.Unmarshal(res.Data, data)
+}
+
+func (c *controllerClient) getShard(namespace, cluster, shard string) (*controllerShard, error) {
+	var res struct {
+		Shard controllerShard `json:"shard"`
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/clusters/%s/shards/%s",
+		url.PathEscape(namespace), url.PathEscape(cluster), url.PathEscape(shard))
+	if err := c.get(path, &res); err != nil {
+		return nil, err
+	}
+	return &res.Shard, nil
+}
+
+func (c *controllerClient) getLeader() (string, error) {
+	var res struct {
+		Leader string `json:"leader"`
+	}
+	if err := c.get("/api/v1/controller/leader", &res); err != nil {
+		return "", err
+	}
+	return res.Leader, nil
+}
+
+func (c *controllerClient) listNamespaces() ([]string, error) {
+	var res struct {
+		Namespaces []string `json:"namespaces"`
+	}
+	if err := c.get("/api/v1/namespaces", &res); err != nil {
+		return nil, err
+	}
+	return res.Namespaces, nil
+}
+
+func (c *controllerClient) listClusters(namespace string) ([]string, error) {
+	var res struct {
+		Clusters []string `json:"clusters"`
+	}
+	if err := c.get(fmt.Sprintf("/api/v1/namespaces/%s/clusters", url.PathEscape(namespace)), &res); err != nil {
+		return nil, err
+	}
+	return res.Clusters, nil
+}
+
+func (c *controllerClient) getCluster(namespace, cluster string) (*controllerCluster, error) {
+	var res struct {
+		Cluster controllerCluster `json:"cluster"`
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/clusters/%s", url.PathEscape(namespace), url.PathEscape(cluster))
+	if err := c.get(path, &res); err != nil {
+		return nil, err
+	}
+	return &res.Cluster, nil
+}
+
+/*
+valid examples:
+  - 0-8191
+  - 8192
+*/
+func parseSlotRange(r string) (start int, end int, ok bool) {
+	var err error
+	parts := strings.SplitN(strings.TrimSpace(r), "-", 2)
+	if start, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, false
+	}
+	end = start
+	if len(parts) == 2 {
+		if end, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, false
+		}
+	}
+	if end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+func (e *Exporter) extractControllerMetrics(ch chan<- prometheus.Metric) {
+	c := e.newControllerClient(e.options.ControllerAddr)
+
+	leader, err := c.getLeader()
+	if err != nil {
+		log.Errorf("Couldn't get kvrocks-controller leader, err: %s", err)
+		e.registerConstMetricGauge(ch, "controller_up", 0)
+		return
+	}
+	e.registerConstMetricGauge(ch, "controller_up", 1)
+	e.registerConstMetricGauge(ch, "controller_leader_info", 1, leader)
+
+	namespaces, err := c.listNamespaces()
+	if err != nil {
+		log.Errorf("Couldn't list kvrocks-controller namespaces, err: %s", err)
+		return
+	}
+
+	for _, ns := range namespaces {
+		clusters, err := c.listClusters(ns)
+		if err != nil {
+			log.Errorf("Couldn't list clusters of namespace %s, err: %s", ns, err)
+			continue
+		}
+
+		for _, name := range clusters {
+			cluster, err := c.getCluster(ns, name)
+			if err != nil {
+				log.Errorf("Couldn't get cluster %s/%s, err: %s", ns, name, err)
+				continue
+			}
+			e.extractControllerClusterMetrics(ch, ns, name, cluster)
+		}
+	}
+}
+
+func (e *Exporter) extractControllerClusterMetrics(ch chan<- prometheus.Metric, namespace, name string, cluster *controllerCluster) {
+	e.registerConstMetricGauge(ch, "controller_cluster_version", float64(cluster.Version), namespace, name)
+	e.registerConstMetricGauge(ch, "controller_cluster_shards", float64(len(cluster.Shards)), namespace, name)
+
+	migrating := 0
+	for idx, shard := range cluster.Shards {
+		shardIdx := strconv.Itoa(idx)
+
+		for _, n := range shard.Nodes {
+			e.registerConstMetricGauge(ch, "controller_shard_node_info", 1, namespace, name, shardIdx, n.ID, n.Addr, n.Role)
+		}
+		e.registerConstMetricGauge(ch, "controller_shard_nodes", float64(len(shard.Nodes)), namespace, name, shardIdx)
+
+		slots := 0
+		for _, r := range shard.SlotRanges {
+			start, end, ok := parseSlotRange(r)
+			if !ok {
+				log.Debugf("invalid slot range %q in shard %s of %s/%s", r, shardIdx, namespace, name)
+				continue
+			}
+			slots += end - start + 1
+			e.registerConstMetricGauge(ch, "controller_shard_slot_range", 1, namespace, name, shardIdx, strconv.Itoa(start), strconv.Itoa(end))
+		}
+		e.registerConstMetricGauge(ch, "controller_shard_slots", float64(slots), namespace, name, shardIdx)
+
+		// the controller migrates one slot at a time, the source shard has migrating_slot set
+		// and target_shard_index pointing to the destination until the slot is done
+		// the destination is a value rather than a label, so the series of a shard stay the same across migrations
+		isMigrating := 0.0
+		targetShard := -1.0
+		if shard.MigratingSlot >= 0 && shard.TargetShardIndex >= 0 {
+			isMigrating = 1
+			targetShard = float64(shard.TargetShardIndex)
+			migrating++
+		}
+		e.registerConstMetricGauge(ch, "controller_shard_migrating", isMigrating, namespace, name, shardIdx)
+		e.registerConstMetricGauge(ch, "controller_shard_migration_target", targetShard, namespace, name, shardIdx)
+		e.registerConstMetricGauge(ch, "controller_shard_migrating_slot", float64(shard.MigratingSlot), namespace, name, shardIdx)
+		e.registerConstMetricGauge(ch, "controller_shard_importing_slot", float64(shard.ImportSlot), namespace, name, shardIdx)
+	}
+	e.registerConstMetricGauge(ch, "controller_cluster_migrating_shards", float64(migrating), namespace, name)
+}
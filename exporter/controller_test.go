@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseSlotRange(t *testing.T) {
+	for _, tst := range []struct {
+		in         string
+		start, end int
+		ok         bool
+	}{
+		{in: "0-8191", start: 0, end: 8191, ok: true},
+		{in: "8192", start: 8192, end: 8192, ok: true},
+		{in: " 100-200 ", start: 100, end: 200, ok: true},
+
+		{in: "", ok: false},
+		{in: "abc", ok: false},
+		{in: "10-x", ok: false},
+		{in: "200-100", ok: false},
+	} {
+		start, end, ok := parseSlotRange(tst.in)
+		if ok != tst.ok {
+			t.Errorf("parseSlotRange(%q) ok: %t, wanted: %t", tst.in, ok, tst.ok)
+			continue
+		}
+		if ok && (start != tst.start || end != tst.end) {
+			t.Errorf("parseSlotRange(%q) got: %d-%d, wanted: %d-%d", tst.in, start, end, tst.start, tst.end)
+		}
+	}
+}
+
+func TestControllerMetrics(t *testing.T) {
+	ctrl := newTestControllerServer(map[string]string{
+		"/api/v1/controller/leader":       `{"data":{"leader":"10.0.0.100:9379"}}`,
+		"/api/v1/namespaces":              `{"data":{"namespaces":["ns1"]}}`,
+		"/api/v1/namespaces/ns1/clusters": `{"data":{"clusters":["cluster1","broken"]}}`,
+		"/api/v1/namespaces/ns1/clusters/cluster1": `{"data":{"cluster":{"name":"cluster1","version":7,"shards":[
+			{"nodes":[{"id":"n1","addr":"10.0.0.1:6666","role":"master"},{"id":"n2","addr":"10.0.0.2:6666","role":"slave"}],
+			 "slot_ranges":["0-8190"],"import_slot":-1,"migrating_slot":8191,"target_shard_index":1},
+			{"nodes":[{"id":"n3","addr":"10.0.0.3:6666","role":"master"}],
+			 "slot_ranges":["8191","8192-16383"],"import_slot":8191,"migrating_slot":-1,"target_shard_index":-1}
+		]}}}`,
+	})
+	defer ctrl.Close()
+
+	e, _ := NewKvrocksExporter("", Options{Namespace: "test", ControllerAddr: strings.TrimPrefix(ctrl.URL, "http://"), Registry: prometheus.NewRegistry()})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/metrics")
+	for _, want := range []string{
+		`test_controller_up 1`,
+		`test_controller_leader_info{leader="10.0.0.100:9379"} 1`,
+		`test_controller_cluster_shards{cluster="cluster1",namespace="ns1"} 2`,
+		`test_controller_cluster_version{cluster="cluster1",namespace="ns1"} 7`,
+		`test_controller_cluster_migrating_shards{cluster="cluster1",namespace="ns1"} 1`,
+		`test_controller_shard_node_info{addr="10.0.0.2:6666",cluster="cluster1",namespace="ns1",node_id="n2",role="slave",shard="0"} 1`,
+		`test_controller_shard_nodes{cluster="cluster1",namespace="ns1",shard="0"} 2`,
+		`test_controller_shard_slots{cluster="cluster1",namespace="ns1",shard="0"} 8191`,
+		`test_controller_shard_slots{cluster="cluster1",namespace="ns1",shard="1"} 8193`,
+		`test_controller_shard_slot_range{cluster="cluster1",end="16383",namespace="ns1",shard="1",start="8192"} 1`,
+		`test_controller_shard_migrating{cluster="cluster1",namespace="ns1",shard="0"} 1`,
+		`test_controller_shard_migrating{cluster="cluster1",namespace="ns1",shard="1"} 0`,
+		`test_controller_shard_migration_target{cluster="cluster1",namespace="ns1",shard="0"} 1`,
+		`test_controller_shard_migration_target{cluster="cluster1",namespace="ns1",shard="1"} -1`,
+		`test_controller_shard_migrating_slot{cluster="cluster1",namespace="ns1",shard="0"} 8191`,
+		`test_controller_shard_importing_slot{cluster="cluster1",namespace="ns1",shard="1"} 8191`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+}
+
+func TestControllerDown(t *testing.T) {
+	ctrl := newTestControllerServer(map[string]string{})
+	defer ctrl.Close()
+
+	e, _ := NewKvrocksExporter("", Options{Namespace: "test", ControllerAddr: ctrl.URL, Registry: prometheus.NewRegistry()})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/metrics")
+	if !strings.Contains(body, `test_controller_up 0`) {
+		t.Errorf("want metrics to include test_controller_up 0, have:\n%s", body)
+	}
+}
+
+func TestControllerNotScrapedPerTarget(t *testing.T) {
+	ctrl := newTestControllerServer(map[string]string{
+		"/api/v1/controller/leader": `{"data":{"leader":"10.0.0.100:9379"}}`,
+		"/api/v1/namespaces":        `{"data":{"namespaces":[]}}`,
+	})
+	defer ctrl.Close()
+
+	e, _ := NewKvrocksExporter("", Options{Namespace: "test", ControllerAddr: strings.TrimPrefix(ctrl.URL, "http://"), Registry: prometheus.NewRegistry()})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/scrape?target=redis://127.0.0.1:1")
+	if strings.Contains(body, "test_controller_") {
+		t.Errorf("didn't expect controller metrics for /scrape, have:\n%s", body)
+	}
+}
@@ -0,0 +1,401 @@
+package exporter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+CommandConfig declares a read-only command the exporter runs on every scrape and how its reply maps to a metric:
+
+	{
+	  "name": "quota_used",
+	  "help": "Quota used by a tenant",
+	  "command": ["HGET", "quota:${tenant}", "used"],
+	  "vars": {"tenant": ["search", "ads"]}
+	}
+
+${var} placeholders in the command are replaced by every value of vars, the value becomes a label named like the var.
+They don't clash with the hash tags of cluster keys like user:{123}, which are taken as they are.
+Path selects the values of the reply:
+
+  - "" the reply itself, e.g. of ZCARD or HGET
+  - "length" the number of elements of an array reply
+  - "pairs" an array of name/value pairs like the reply of HGETALL, the names become the PathLabel label (default "field")
+  - "elements" every element of an array reply, the index becomes the PathLabel label (default "index")
+
+Regex is applied to the values, its named groups become labels, and the group named value is the value of the metric,
+1 if there's no such group. Values not matching are skipped.
+*/
+type CommandConfig struct {
+	Name      string              `json:"name"`
+	Type      string              `json:"type"`
+	Help      string              `json:"help"`
+	Command   []string            `json:"command"`
+	Vars      map[string][]string `json:"vars"`
+	Labels    map[string]string   `json:"labels"`
+	Path      string              `json:"path"`
+	PathLabel string              `json:"path_label"`
+	Regex     string              `json:"regex"`
+}
+
+// read-only commands without subcommands, all other commands are denied as they might write, block or change the
+// server, e.g. SORT, which can STORE, has SORT_RO here
+var readOnlyCommands = map[string]bool{
+	// keys
+	"DBSIZE": true, "EXISTS": true, "EXPIRETIME": true, "PEXPIRETIME": true, "PTTL": true, "RANDOMKEY": true,
+	"SCAN": true, "SORT_RO": true, "TTL": true, "TYPE": true,
+	// strings and bitmaps
+	"BITCOUNT": true, "BITFIELD_RO": true, "BITPOS": true, "GET": true, "GETBIT": true, "GETRANGE": true, "LCS": true,
+	"MGET": true, "STRLEN": true, "SUBSTR": true,
+	// hashes
+	"HEXISTS": true, "HGET": true, "HGETALL": true, "HKEYS": true, "HLEN": true, "HMGET": true, "HRANDFIELD": true,
+	"HRANGEBYLEX": true, "HSCAN": true, "HSTRLEN": true, "HVALS": true,
+	// lists
+	"LINDEX": true, "LLEN": true, "LPOS": true, "LRANGE": true,
+	// sets and Kvrocks sorted integers
+	"SCARD": true, "SDIFF": true, "SINTER": true, "SINTERCARD": true, "SISMEMBER": true, "SMEMBERS": true,
+	"SMISMEMBER": true, "SRANDMEMBER": true, "SSCAN": true, "SUNION": true,
+	"SICARD": true, "SIEXISTS": true, "SIRANGE": true, "SIREVRANGE": true, "SIRANGEBYVALUE": true, "SIREVRANGEBYVALUE": true,
+	// sorted sets
+	"ZCARD": true, "ZCOUNT": true, "ZDIFF": true, "ZINTER": true, "ZINTERCARD": true, "ZLEXCOUNT": true, "ZMSCORE": true,
+	"ZRANDMEMBER": true, "ZRANGE": true, "ZRANGEBYLEX": true, "ZRANGEBYSCORE": true, "ZRANK": true, "ZREVRANGE": true,
+	"ZREVRANGEBYLEX": true, "ZREVRANGEBYSCORE": true, "ZREVRANK": true, "ZSCAN": true, "ZSCORE": true, "ZUNION": true,
+	// geo, streams, HyperLogLogs and bloom filters
+	"GEODIST": true, "GEOHASH": true, "GEOPOS": true, "GEORADIUS_RO": true, "GEORADIUSBYMEMBER_RO": true, "GEOSEARCH": true,
+	"XLEN": true, "XPENDING": true, "XRANGE": true, "XREVRANGE": true,
+	"PFCOUNT": true,
+	"BF.CARD": true, "BF.EXISTS": true, "BF.INFO": true, "BF.MEXISTS": true,
+	// JSON
+	"JSON.ARRINDEX": true, "JSON.ARRLEN": true, "JSON.GET": true, "JSON.MGET": true, "JSON.OBJKEYS": true,
+	"JSON.OBJLEN": true, "JSON.RESP": true, "JSON.STRLEN": true, "JSON.TYPE": true,
+	// search
+	"FT._LIST": true, "FT.EXPLAIN": true, "FT.EXPLAINSQL": true, "FT.INFO": true, "FT.SEARCH": true, "FT.SEARCHSQL": true,
+	"FT.TAGVALS": true,
+	// server
+	"ECHO": true, "INFO": true, "LASTSAVE": true, "PING": true, "ROLE": true, "TIME": true,
+}
+
+// read-only subcommands of the commands with subcommands, all other subcommands are denied
+var allowedSubcommands = map[string]map[string]bool{
+	"CLIENT":    {"LIST": true, "INFO": true, "GETNAME": true, "ID": true},
+	"CLUSTER":   {"INFO": true, "NODES": true, "SLOTS": true, "KEYSLOT": true, "COUNTKEYSINSLOT": true, "MYID": true},
+	"CONFIG":    {"GET": true},
+	"NAMESPACE": {"GET": true},
+	"SCRIPT":    {"EXISTS": true},
+	"SLOWLOG":   {"GET": true, "LEN": true},
+	"XINFO":     {"STREAM": true, "GROUPS": true, "CONSUMERS": true},
+	"MEMORY":    {"USAGE": true, "STATS": true},
+	"OBJECT":    {"ENCODING": true, "FREQ": true, "IDLETIME": true, "REFCOUNT": true},
+	"DISK":      {"USAGE": true},
+	"COMMAND":   {"COUNT": true, "INFO": true},
+	"PUBSUB":    {"CHANNELS": true, "NUMPAT": true, "NUMSUB": true},
+}
+
+// checkReadOnlyCommand returns an error for commands that aren't known to be read-only
+func checkReadOnlyCommand(cmd []string) error {
+	if len(cmd) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	name := strings.ToUpper(cmd[0])
+	if subs, ok := allowedSubcommands[name]; ok {
+		if len(cmd) < 2 || !subs[strings.ToUpper(cmd[1])] {
+			return fmt.Errorf("%s isn't a read-only command", strings.Join(cmd[:min(len(cmd), 2)], " "))
+		}
+		return nil
+	}
+	if !readOnlyCommands[name] {
+		return fmt.Errorf("%s isn't a read-only command", name)
+	}
+	return nil
+}
+
+var commandVarRE = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// customCommand is a CommandConfig checked and prepared for running it
+type customCommand struct {
+	CommandConfig
+
+	regex      *regexp.Regexp
+	valueGroup int // index of the group named value, 0 if there's none
+	labels     []string
+	desc       *prometheus.Desc
+	valueType  prometheus.ValueType
+}
+
+// validate checks the command and prepares it for running it, the label names are sorted like the label values of its metrics
+func (c *CommandConfig) validate() (*customCommand, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("command %v has no name", c.Command)
+	}
+	if err := checkReadOnlyCommand(c.Command); err != nil {
+		return nil, fmt.Errorf("command %s: %w", c.Name, err)
+	}
+
+	cc := &customCommand{CommandConfig: *c, valueType: prometheus.GaugeValue}
+	switch c.Type {
+	case "", "gauge":
+	case "counter":
+		cc.valueType = prometheus.CounterValue
+	default:
+		return nil, fmt.Errorf("command %s: invalid type %q, valid types are gauge and counter", c.Name, c.Type)
+	}
+
+	for _, arg := range c.Command {
+		for _, m := range commandVarRE.FindAllStringSubmatch(arg, -1) {
+			if len(c.Vars[m[1]]) == 0 {
+				return nil, fmt.Errorf("command %s: no values for ${%s}", c.Name, m[1])
+			}
+		}
+	}
+
+	for name := range c.Labels {
+		cc.labels = append(cc.labels, name)
+	}
+	for name := range c.Vars {
+		cc.labels = append(cc.labels, name)
+	}
+	sort.Strings(cc.labels)
+
+	switch c.Path {
+	case "", "length":
+	case "pairs", "elements":
+		if cc.PathLabel == "" {
+			cc.PathLabel = map[string]string{"pairs": "field", "elements": "index"}[c.Path]
+		}
+		cc.labels = append(cc.labels, cc.PathLabel)
+	default:
+		return nil, fmt.Errorf("command %s: invalid path %q, valid paths are length, pairs and elements", c.Name, c.Path)
+	}
+
+	if c.Regex != "" {
+		re, err := regexp.Compile(c.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("command %s: invalid regex %q: %s", c.Name, c.Regex, err)
+		}
+		cc.regex = re
+		for i, name := range re.SubexpNames() {
+			switch {
+			case name == "value":
+				cc.valueGroup = i
+			case name != "":
+				cc.labels = append(cc.labels, name)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, l := range cc.labels {
+		if seen[l] {
+			return nil, fmt.Errorf("command %s: label %s is used twice", c.Name, l)
+		}
+		seen[l] = true
+	}
+	return cc, nil
+}
+
+/*
+newCustomCommands validates the commands and builds the descriptors of their metrics.
+Commands can share a metric name if they have the same labels, the names of the metrics of the exporter itself can't be used.
+*/
+func (e *Exporter) newCustomCommands(cmds []CommandConfig) ([]*customCommand, error) {
+	descs := map[string]*customCommand{}
+	var res []*customCommand
+	for i := range cmds {
+		cc, err := cmds[i].validate()
+		if err != nil {
+			return nil, err
+		}
+		name := sanitizeMetricName(cc.Name)
+		if _, ok := e.metricDescriptions[name]; ok {
+			return nil, fmt.Errorf("command %s: metric %s of the exporter can't be used", cc.Name, name)
+		}
+		if prev, ok := descs[name]; ok {
+			if strings.Join(prev.labels, ",") != strings.Join(cc.labels, ",") || prev.valueType != cc.valueType {
+				return nil, fmt.Errorf("command %s: metric %s is declared with other labels or type already", cc.Name, name)
+			}
+			cc.desc = prev.desc
+		} else {
+			help := cc.Help
+			if help == "" {
+				help = "Reply of " + strings.Join(cc.Command, " ")
+			}
+			cc.desc = newMetricDescr(e.options.Namespace, name, help, cc.labels, e.options.ConstLabels)
+			descs[name] = cc
+		}
+		res = append(res, cc)
+	}
+	return res, nil
+}
+
+// expand returns the commands with their ${var} placeholders replaced, together with the values of the vars
+func (cc *customCommand) expand() (cmds [][]interface{}, vars []map[string]string) {
+	combinations := []map[string]string{{}}
+	names := make([]string, 0, len(cc.Vars))
+	for name := range cc.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var next []map[string]string
+		for _, comb := range combinations {
+			for _, v := range cc.Vars[name] {
+				c := map[string]string{name: v}
+				for k, val := range comb {
+					c[k] = val
+				}
+				next = append(next, c)
+			}
+		}
+		combinations = next
+	}
+
+	for _, comb := range combinations {
+		cmd := make([]interface{}, 0, len(cc.Command))
+		for _, arg := range cc.Command {
+			cmd = append(cmd, commandVarRE.ReplaceAllStringFunc(arg, func(m string) string {
+				return comb[m[2:len(m)-1]]
+			}))
+		}
+		cmds = append(cmds, cmd)
+		vars = append(vars, comb)
+	}
+	return cmds, vars
+}
+
+type customValue struct {
+	key   string // name of the pair or index of the element
+	value interface{}
+}
+
+// values returns the values of the reply selected by the path
+func (cc *customCommand) values(reply interface{}) ([]customValue, error) {
+	switch cc.Path {
+	case "length":
+		values, err := redis.Values(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		return []customValue{{value: int64(len(values))}}, nil
+	case "pairs":
+		values, err := redis.Values(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(values)%2 != 0 {
+			return nil, fmt.Errorf("expected name/value pairs, got %d elements", len(values))
+		}
+		var res []customValue
+		for i := 0; i < len(values); i += 2 {
+			name, err := redis.String(values[i], nil)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, customValue{key: name, value: values[i+1]})
+		}
+		return res, nil
+	case "elements":
+		values, err := redis.Values(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		res := make([]customValue, 0, len(values))
+		for i, v := range values {
+			res = append(res, customValue{key: strconv.Itoa(i), value: v})
+		}
+		return res, nil
+	}
+	return []customValue{{value: reply}}, nil
+}
+
+func (e *Exporter) extractCustomCommandMetrics(ch chan<- prometheus.Metric, c redis.Conn) {
+	for _, cc := range e.customCommands {
+		success := 1.0
+		cmds, vars := cc.expand()
+		for i, cmd := range cmds {
+			if err := e.runCustomCommand(ch, c, cc, cmd, vars[i]); err != nil {
+				log.Errorf("Command %s of %s failed, err: %s", cmd, cc.Name, err)
+				success = 0
+			}
+		}
+		e.registerConstMetricGauge(ch, "custom_command_success", success, cc.Name)
+	}
+}
+
+func (e *Exporter) runCustomCommand(ch chan<- prometheus.Metric, c redis.Conn, cc *customCommand, cmd []interface{}, vars map[string]string) error {
+	reply, err := doRedisCmd(c, cmd[0].(string), cmd[1:]...)
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		// e.g. HGET of a field that doesn't exist
+		return nil
+	}
+
+	values, err := cc.values(reply)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range values {
+		lbls := map[string]string{}
+		for name, value := range cc.Labels {
+			lbls[name] = value
+		}
+		for name, value := range vars {
+			lbls[name] = value
+		}
+		if cc.PathLabel != "" {
+			lbls[cc.PathLabel] = v.key
+		}
+
+		var val float64
+		if cc.regex != nil {
+			var s string
+			if i, ok := v.value.(int64); ok {
+				s = strconv.FormatInt(i, 10)
+			} else if s, err = redis.String(v.value, nil); err != nil {
+				log.Debugf("Skipping value %v of %s, it's not a string, err: %s", v.value, cc.Name, err)
+				continue
+			}
+			m := cc.regex.FindStringSubmatch(s)
+			if m == nil {
+				continue
+			}
+			for i, name := range cc.regex.SubexpNames() {
+				if name != "" && name != "value" {
+					lbls[name] = m[i]
+				}
+			}
+			val = 1
+			if cc.valueGroup > 0 {
+				if val, err = strconv.ParseFloat(m[cc.valueGroup], 64); err != nil {
+					return fmt.Errorf("invalid value %q: %s", m[cc.valueGroup], err)
+				}
+			}
+		} else if val, err = replyFloat(v.value); err != nil {
+			if v.value == nil {
+				continue
+			}
+			return err
+		}
+
+		lblValues := make([]string, len(cc.labels))
+		for i, name := range cc.labels {
+			lblValues[i] = lbls[name]
+		}
+		m, err := prometheus.NewConstMetric(cc.desc, cc.valueType, val, lblValues...)
+		if err != nil {
+			return err
+		}
+		ch <- m
+	}
+	return nil
+}
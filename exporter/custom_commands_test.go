@@ -0,0 +1,198 @@
+package exporter
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCheckReadOnlyCommand(t *testing.T) {
+	for _, tst := range []struct {
+		cmd []string
+		err bool
+	}{
+		{cmd: []string{"ZCARD", "delayed_jobs"}},
+		{cmd: []string{"hget", "quota:${tenant}", "used"}},
+		{cmd: []string{"NAMESPACE", "GET", "*"}},
+		{cmd: []string{"config", "get", "maxclients"}},
+		{cmd: []string{}, err: true},
+		{cmd: []string{"SET", "a", "1"}, err: true},
+		{cmd: []string{"del", "a"}, err: true},
+		{cmd: []string{"EVAL", "return 1", "0"}, err: true},
+		{cmd: []string{"BLPOP", "jobs", "0"}, err: true},
+		{cmd: []string{"CONFIG", "SET", "maxclients", "1"}, err: true},
+		{cmd: []string{"NAMESPACE", "DEL", "ns"}, err: true},
+		{cmd: []string{"CLUSTER"}, err: true},
+		{cmd: []string{"flushall"}, err: true},
+		{cmd: []string{"SORT_RO", "jobs"}},
+		{cmd: []string{"JSON.GET", "doc", "$.count"}},
+		{cmd: []string{"GEOSEARCH", "shops", "FROMLONLAT", "0", "0", "BYRADIUS", "1", "km"}},
+		{cmd: []string{"SIRANGE", "ids", "0", "10"}},
+		{cmd: []string{"PUBSUB", "NUMSUB", "jobs"}},
+
+		// writers of Kvrocks
+		{cmd: []string{"CAS", "a", "old", "new"}, err: true},
+		{cmd: []string{"CAD", "a", "old"}, err: true},
+		{cmd: []string{"SIADD", "ids", "1"}, err: true},
+		{cmd: []string{"SIREM", "ids", "1"}, err: true},
+		{cmd: []string{"RDB", "LOAD", "dump.rdb"}, err: true},
+		{cmd: []string{"CLUSTERX", "SETNODES", "", "1"}, err: true},
+		// other writers
+		{cmd: []string{"LMPOP", "1", "jobs", "LEFT"}, err: true},
+		{cmd: []string{"BLMPOP", "0", "1", "jobs", "LEFT"}, err: true},
+		{cmd: []string{"BZMPOP", "0", "1", "jobs", "MIN"}, err: true},
+		{cmd: []string{"GEOSEARCHSTORE", "dst", "shops", "FROMLONLAT", "0", "0", "BYRADIUS", "1", "km"}, err: true},
+		{cmd: []string{"ZDIFFSTORE", "dst", "2", "a", "b"}, err: true},
+		{cmd: []string{"SORT", "jobs", "STORE", "dst"}, err: true},
+		{cmd: []string{"JSON.ARRAPPEND", "doc", "$.list", "1"}, err: true},
+		{cmd: []string{"JSON.NUMINCRBY", "doc", "$.count", "1"}, err: true},
+		{cmd: []string{"JSON.CLEAR", "doc"}, err: true},
+		{cmd: []string{"JSON.MERGE", "doc", "$", "{}"}, err: true},
+		// unknown commands
+		{cmd: []string{"NOPE"}, err: true},
+	} {
+		if err := checkReadOnlyCommand(tst.cmd); (err != nil) != tst.err {
+			t.Errorf("checkReadOnlyCommand(%v) err: %v, want error: %v", tst.cmd, err, tst.err)
+		}
+	}
+}
+
+func TestLoadConfigFileCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	for _, tst := range []struct {
+		cfg string
+		err bool
+	}{
+		{cfg: `{"commands": [{"name": "delayed_jobs", "command": ["ZCARD", "delayed_jobs"], "type": "gauge"}]}`},
+		{cfg: `{"commands": [{"name": "jobs", "command": ["HGETALL", "jobs"], "path": "pairs", "regex": "^(?P<value>\\d+)$"}]}`},
+		{cfg: `{"commands": [{"name": "jobs", "command": ["SET", "jobs", "1"]}]}`, err: true},
+		{cfg: `{"commands": [{"command": ["ZCARD", "delayed_jobs"]}]}`, err: true},
+		{cfg: `{"commands": [{"name": "jobs", "command": ["ZCARD", "delayed_jobs"], "type": "summary"}]}`, err: true},
+		{cfg: `{"commands": [{"name": "jobs", "command": ["ZCARD", "delayed_jobs"], "path": "$[0]"}]}`, err: true},
+		{cfg: `{"commands": [{"name": "jobs", "command": ["ZCARD", "jobs:${queue}"]}]}`, err: true},
+		{cfg: `{"commands": [{"name": "jobs", "command": ["ZCARD", "jobs:{queue}"]}]}`},
+		{cfg: `{"commands": [{"name": "jobs", "command": ["GET", "jobs"], "regex": "("}]}`, err: true},
+		{cfg: `{"commands": [{"name": "jobs", "command": ["GET", "jobs"], "labels": {"queue": "a"}, "regex": "(?P<queue>\\w+)"}]}`, err: true},
+	} {
+		if err := os.WriteFile(path, []byte(tst.cfg), 0o600); err != nil {
+			t.Fatalf("couldn't write config: %s", err)
+		}
+		if _, err := LoadConfigFile(path); (err != nil) != tst.err {
+			t.Errorf("LoadConfigFile(%s) err: %v, want error: %v", tst.cfg, err, tst.err)
+		}
+	}
+}
+
+func TestCustomCommandMetrics(t *testing.T) {
+	b := testCaptureBundle(t)
+	for _, r := range []struct {
+		cmd []string
+		v   interface{}
+	}{
+		{cmd: []string{"ZCARD", "delayed_jobs"}, v: int64(7)},
+		{cmd: []string{"HGET", "quota:search", "used"}, v: []byte("12.5")},
+		{cmd: []string{"HGET", "quota:ads", "used"}, v: nil},
+		{cmd: []string{"NAMESPACE", "GET", "*"}, v: []interface{}{[]byte("ns1"), []byte("token1"), []byte("ns2"), []byte("token2")}},
+		{cmd: []string{"HGETALL", "workers"}, v: []interface{}{[]byte("w1"), []byte("busy:3"), []byte("w2"), []byte("idle:0"), []byte("w3"), []byte("broken")}},
+		{cmd: []string{"LRANGE", "totals", "0", "-1"}, v: []interface{}{[]byte("5"), []byte("8")}},
+		{cmd: []string{"GET", "version"}, v: []byte("v2.10.1")},
+		{cmd: []string{"GET", "missing_number"}, v: []byte("many")},
+		{cmd: []string{"HGET", "user:{123}", "logins"}, v: []byte("4")},
+		{cmd: []string{"ZCARD", "user:{123}:sessions"}, v: int64(17)},
+	} {
+		val, err := captureValue(r.v)
+		if err != nil {
+			t.Fatalf("captureValue() err: %s", err)
+		}
+		b.Replies = append(b.Replies, CapturedReply{Command: r.cmd, Reply: val})
+	}
+
+	cmds := []CommandConfig{
+		{Name: "delayed_jobs", Help: "Jobs waiting to be run", Command: []string{"ZCARD", "delayed_jobs"}, Labels: map[string]string{"queue": "default"}},
+		{Name: "quota_used", Command: []string{"HGET", "quota:${tenant}", "used"}, Vars: map[string][]string{"tenant": {"search", "ads"}}},
+		{Name: "namespace", Command: []string{"NAMESPACE", "GET", "*"}, Path: "pairs", PathLabel: "namespace", Regex: "."},
+		{Name: "workers", Command: []string{"HGETALL", "workers"}, Path: "length"},
+		{Name: "worker_jobs", Command: []string{"HGETALL", "workers"}, Path: "pairs", PathLabel: "worker", Regex: `^(?P<state>\w+):(?P<value>\d+)$`},
+		{Name: "totals", Type: "counter", Command: []string{"LRANGE", "totals", "0", "-1"}, Path: "elements"},
+		{Name: "app_version", Command: []string{"GET", "version"}, Regex: `^v(?P<version>.+)$`},
+		{Name: "not_a_number", Command: []string{"GET", "missing_number"}},
+		{Name: "user_logins", Command: []string{"HGET", "user:{123}", "logins"}},
+		{Name: "user_sessions", Command: []string{"ZCARD", "user:{123}:sessions"}, Regex: `^(?P<value>1\d)$`},
+	}
+	e, err := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", CustomCommands: cmds, ReplayBundle: b, Registry: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatalf("NewKvrocksExporter() err: %s", err)
+	}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/metrics")
+	for _, want := range []string{
+		"# HELP test_delayed_jobs Jobs waiting to be run",
+		`test_delayed_jobs{queue="default"} 7`,
+		`test_quota_used{tenant="search"} 12.5`,
+		`test_namespace{namespace="ns1"} 1`,
+		`test_namespace{namespace="ns2"} 1`,
+		`test_workers 6`,
+		`test_worker_jobs{state="busy",worker="w1"} 3`,
+		`test_worker_jobs{state="idle",worker="w2"} 0`,
+		"# TYPE test_totals counter",
+		`test_totals{index="0"} 5`,
+		`test_totals{index="1"} 8`,
+		`test_app_version{version="2.10.1"} 1`,
+		`test_custom_command_success{name="quota_used"} 1`,
+		`test_custom_command_success{name="not_a_number"} 0`,
+		`test_user_logins 4`,
+		`test_user_sessions 17`,
+		`test_up 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+	for _, notWant := range []string{`tenant="ads"`, `worker="w3"`, "test_not_a_number ", "token1"} {
+		if strings.Contains(body, notWant) {
+			t.Errorf("didn't want metrics to include %q, have:\n%s", notWant, body)
+		}
+	}
+}
+
+func TestCustomCommandNames(t *testing.T) {
+	for _, cmds := range [][]CommandConfig{
+		{{Name: "up", Command: []string{"DBSIZE"}}},
+		{
+			{Name: "jobs", Command: []string{"LLEN", "a"}, Labels: map[string]string{"queue": "a"}},
+			{Name: "jobs", Command: []string{"LLEN", "b"}},
+		},
+	} {
+		if _, err := NewKvrocksExporter("localhost:6666", Options{CustomCommands: cmds}); err == nil {
+			t.Errorf("expected error for commands %v", cmds)
+		}
+	}
+
+	cmds := []CommandConfig{
+		{Name: "jobs", Command: []string{"LLEN", "a"}, Labels: map[string]string{"queue": "a"}},
+		{Name: "jobs", Command: []string{"LLEN", "b"}, Labels: map[string]string{"queue": "b"}},
+	}
+	if _, err := NewKvrocksExporter("localhost:6666", Options{CustomCommands: cmds}); err != nil {
+		t.Errorf("NewKvrocksExporter() err: %s", err)
+	}
+}
+
+func TestCustomCommandValues(t *testing.T) {
+	cc, err := (&CommandConfig{Name: "jobs", Command: []string{"HGETALL", "jobs"}, Path: "pairs"}).validate()
+	if err != nil {
+		t.Fatalf("validate() err: %s", err)
+	}
+	if _, err := cc.values([]interface{}{[]byte("a")}); err == nil {
+		t.Errorf("expected error for an odd number of elements")
+	}
+	if _, err := cc.values(redis.Error("WRONGTYPE")); err == nil {
+		t.Errorf("expected error for a reply that isn't an array")
+	}
+}
@@ -0,0 +1,211 @@
+package exporter
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+	Discovery targets resolve the current master (and optionally its replicas) on every scrape:
+	  - sentinel://[:password@]sentinel-host:26379/mymaster
+	  - controller://controller-host:9379/<namespace>/<cluster>/<shard index>
+*/
+
+type discoveredNode struct {
+	addr string
+	role string
+}
+
+func isDiscoveryURI(uri string) bool {
+	return strings.HasPrefix(uri, "sentinel://") || strings.HasPrefix(uri, "controller://")
+}
+
+// discoveryService returns the stable name of the service behind a discovery target,
+// it's used for the "service" label of all metrics of that target.
+func discoveryService(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+
+	path := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case "sentinel":
+		if path == "" || strings.Contains(path, "/") {
+			return "", fmt.Errorf("invalid sentinel target %q, expected sentinel://host:port/<master name>", uri)
+		}
+	case "controller":
+		if len(strings.Split(path, "/")) != 3 {
+			return "", fmt.Errorf("invalid controller target %q, expected controller://host:port/<namespace>/<cluster>/<shard>", uri)
+		}
+	default:
+		return "", fmt.Errorf("unsupported discovery scheme %q", u.Scheme)
+	}
+	return path, nil
+}
+
+func (e *Exporter) discoverNodes() ([]discoveredNode, error) {
+	u, err := url.Parse(e.kvrocksAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "sentinel":
+		return e.discoverSentinelNodes(u)
+	case "controller":
+		return e.discoverControllerNodes(u)
+	}
+	return nil, fmt.Errorf("unsupported discovery scheme %q", u.Scheme)
+}
+
+func (e *Exporter) discoverSentinelNodes(u *url.URL) ([]discoveredNode, error) {
+	masterName := strings.Trim(u.Path, "/")
+
+	options := []redis.DialOption{
+		redis.DialConnectTimeout(e.options.ConnectionTimeouts),
+		redis.DialReadTimeout(e.options.ConnectionTimeouts),
+		redis.DialWriteTimeout(e.options.ConnectionTimeouts),
+	}
+	if pwd, ok := u.User.Password(); ok {
+		options = append(options, redis.DialPassword(pwd))
+	}
+
+	c, err := redis.Dial("tcp", u.Host, options...)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	addr, err := redis.Strings(doRedisCmd(c, "SENTINEL", "GET-MASTER-ADDR-BY-NAME", masterName))
+	if err != nil {
+		return nil, err
+	}
+	if len(addr) != 2 {
+		return nil, fmt.Errorf("sentinel doesn't know master %q", masterName)
+	}
+	nodes := []discoveredNode{{addr: "redis://" + net.JoinHostPort(addr[0], addr[1]), role: "master"}}
+
+	if !e.options.DiscoverReplicas {
+		return nodes, nil
+	}
+
+	replicas, err := redis.Values(doRedisCmd(c, "SENTINEL", "REPLICAS", masterName))
+	if err != nil {
+		// Sentinel versions before 5.0 only know the SLAVES sub-command
+		replicas, err = redis.Values(doRedisCmd(c, "SENTINEL", "SLAVES", masterName))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(nodes, parseSentinelReplicas(replicas)...), nil
+}
+
+/*
+SENTINEL REPLICAS returns one flat list of field/value pairs per replica, e.g.
+  - name 10.0.0.2:6666 ip 10.0.0.2 port 6666 flags slave ...
+*/
+func parseSentinelReplicas(replicas []interface{}) []discoveredNode {
+	var nodes []discoveredNode
+	for _, r := range replicas {
+		fields, err := redis.StringMap(r, nil)
+		if err != nil {
+			log.Debugf("parseSentinelReplicas() err: %s", err)
+			continue
+		}
+		if fields["ip"] == "" || fields["port"] == "" {
+			continue
+		}
+
+		down := false
+		for _, flag := range strings.Split(fields["flags"], ",") {
+			if flag == "s_down" || flag == "o_down" || flag == "disconnected" {
+				down = true
+			}
+		}
+		if down {
+			log.Debugf("skipping replica %s:%s, flags: %s", fields["ip"], fields["port"], fields["flags"])
+			continue
+		}
+		nodes = append(nodes, discoveredNode{addr: "redis://" + net.JoinHostPort(fields["ip"], fields["port"]), role: "slave"})
+	}
+	return nodes
+}
+
+func (e *Exporter) discoverControllerNodes(u *url.URL) ([]discoveredNode, error) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid controller target path %q", u.Path)
+	}
+
+	shard, err := e.newControllerClient(u.Host).getShard(parts[0], parts[1], parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []discoveredNode
+	for _, n := range shard.Nodes {
+		if n.Role == "master" {
+			// the master always goes first
+			nodes = append([]discoveredNode{{addr: "redis://" + n.Addr, role: "master"}}, nodes...)
+		} else if e.options.DiscoverReplicas {
+			nodes = append(nodes, discoveredNode{addr: "redis://" + n.Addr, role: "slave"})
+		}
+	}
+	if len(nodes) == 0 || nodes[0].role != "master" {
+		return nil, fmt.Errorf("controller reports no master for shard %s", strings.Join(parts, "/"))
+	}
+	return nodes, nil
+}
+
+// collectDiscoveredNodes resolves the nodes behind a discovery target and scrapes each of them.
+// The master's series carry only the "service" label so they stay stable across failovers,
+// replica series additionally carry a "replica" label with the replica's address.
+func (e *Exporter) collectDiscoveredNodes(ch chan<- prometheus.Metric) {
+	nodes, err := e.discoverNodes()
+	if err != nil {
+		log.Errorf("Couldn't discover nodes of %s, err: %s", e.kvrocksAddr, err)
+		e.registerConstMetricGauge(ch, "exporter_last_scrape_error", 1.0, fmt.Sprintf("%s", err))
+		e.registerConstMetricGauge(ch, "up", 0)
+		return
+	}
+
+	// the exporters of the nodes are kept until the nodes go away, so the samplers and counters of their
+	// collectors carry on across scrapes. A node that changed its role gets a new one for its new labels.
+	current := map[string]*Exporter{}
+	for _, n := range nodes {
+		if n.role == "master" {
+			e.registerConstMetricGauge(ch, "discovery_master_info", 1, strings.TrimPrefix(n.addr, "redis://"))
+		}
+
+		key := n.role + " " + n.addr
+		node := e.discoveredNodes[key]
+		if node == nil {
+			var err error
+			if node, err = e.newDiscoveredNodeExporter(n); err != nil {
+				log.Errorf("NewKvrocksExporter( %s ) err: %s", n.addr, err)
+				continue
+			}
+		}
+		current[key] = node
+
+		log.Debugf("scraping discovered %s %s", n.role, n.addr)
+		node.collectTarget(ch)
+	}
+	e.discoveredNodes = current
+}
+
+func (e *Exporter) newDiscoveredNodeExporter(n discoveredNode) (*Exporter, error) {
+	opts := e.options
+	opts.Registry = nil
+	if n.role != "master" {
+		opts.ConstLabels = mergeLabels(opts.ConstLabels, prometheus.Labels{"replica": strings.TrimPrefix(n.addr, "redis://")})
+	}
+	return e.newChildExporter(n.addr, opts)
+}
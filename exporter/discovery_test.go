@@ -0,0 +1,181 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDiscoveryService(t *testing.T) {
+	for _, tst := range []struct {
+		uri     string
+		want    string
+		wantErr bool
+	}{
+		{uri: "sentinel://localhost:26379/mymaster", want: "mymaster"},
+		{uri: "sentinel://:pwd@localhost:26379/mymaster/", want: "mymaster"},
+		{uri: "controller://localhost:9379/ns1/cluster1/0", want: "ns1/cluster1/0"},
+
+		{uri: "sentinel://localhost:26379", wantErr: true},
+		{uri: "sentinel://localhost:26379/a/b", wantErr: true},
+		{uri: "controller://localhost:9379/ns1/cluster1", wantErr: true},
+		{uri: "redis://localhost:6666", wantErr: true},
+	} {
+		t.Run(tst.uri, func(t *testing.T) {
+			got, err := discoveryService(tst.uri)
+			if tst.wantErr {
+				if err == nil {
+					t.Fatalf("expected err, got service: %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if got != tst.want {
+				t.Fatalf("got: %s, wanted: %s", got, tst.want)
+			}
+		})
+	}
+}
+
+func TestParseSentinelReplicas(t *testing.T) {
+	replicas := []interface{}{
+		[]interface{}{[]byte("name"), []byte("10.0.0.2:6666"), []byte("ip"), []byte("10.0.0.2"), []byte("port"), []byte("6666"), []byte("flags"), []byte("slave")},
+		[]interface{}{[]byte("name"), []byte("10.0.0.3:6666"), []byte("ip"), []byte("10.0.0.3"), []byte("port"), []byte("6666"), []byte("flags"), []byte("slave,s_down")},
+		[]interface{}{[]byte("name"), []byte("broken")},
+	}
+
+	nodes := parseSentinelReplicas(replicas)
+	if len(nodes) != 1 {
+		t.Fatalf("expected 1 replica, got: %#v", nodes)
+	}
+	if nodes[0].addr != "redis://10.0.0.2:6666" || nodes[0].role != "slave" {
+		t.Errorf("unexpected replica: %#v", nodes[0])
+	}
+}
+
+func newTestControllerServer(routes map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := routes[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"message":"not found"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func TestDiscoverControllerNodes(t *testing.T) {
+	ts := newTestControllerServer(map[string]string{
+		"/api/v1/namespaces/ns1/clusters/cluster1/shards/0": `{"data":{"shard":{"nodes":[
+			{"id":"n2","addr":"10.0.0.2:6666","role":"slave"},
+			{"id":"n1","addr":"10.0.0.1:6666","role":"master"}
+		]}}}`,
+	})
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	for _, tst := range []struct {
+		name     string
+		replicas bool
+		want     []string
+	}{
+		{name: "master-only", want: []string{"redis://10.0.0.1:6666"}},
+		{name: "with-replicas", replicas: true, want: []string{"redis://10.0.0.1:6666", "redis://10.0.0.2:6666"}},
+	} {
+		t.Run(tst.name, func(t *testing.T) {
+			e, err := NewKvrocksExporter("controller://"+host+"/ns1/cluster1/0", Options{Namespace: "test", DiscoverReplicas: tst.replicas})
+			if err != nil {
+				t.Fatalf("NewKvrocksExporter() err: %s", err)
+			}
+			nodes, err := e.discoverNodes()
+			if err != nil {
+				t.Fatalf("discoverNodes() err: %s", err)
+			}
+			if len(nodes) != len(tst.want) {
+				t.Fatalf("got nodes: %#v, wanted: %#v", nodes, tst.want)
+			}
+			for i, n := range nodes {
+				if n.addr != tst.want[i] {
+					t.Errorf("got node %d: %s, wanted: %s", i, n.addr, tst.want[i])
+				}
+			}
+		})
+	}
+
+	e, _ := NewKvrocksExporter("controller://"+host+"/ns1/cluster1/7", Options{Namespace: "test"})
+	if _, err := e.discoverNodes(); err == nil {
+		t.Errorf("expected error for unknown shard")
+	}
+}
+
+func TestDiscoveryServiceLabel(t *testing.T) {
+	ts := newTestControllerServer(map[string]string{})
+	defer ts.Close()
+
+	r := prometheus.NewRegistry()
+	e, err := NewKvrocksExporter("controller://"+strings.TrimPrefix(ts.URL, "http://")+"/ns1/cluster1/0", Options{Namespace: "test", Registry: r})
+	if err != nil {
+		t.Fatalf("NewKvrocksExporter() err: %s", err)
+	}
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	body := downloadURL(t, srv.URL+"/metrics")
+	for _, want := range []string{
+		`test_up{service="ns1/cluster1/0"} 0`,
+		`test_exporter_scrapes_total{service="ns1/cluster1/0"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+}
+
+func TestDiscoveredNodeExportersAreKept(t *testing.T) {
+	shard := `{"data":{"shard":{"nodes":[
+		{"id":"n1","addr":"127.0.0.1:1","role":"master"},
+		{"id":"n2","addr":"127.0.0.1:2","role":"slave"}
+	]}}}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(shard))
+	}))
+	defer ts.Close()
+
+	e, err := NewKvrocksExporter("controller://"+strings.TrimPrefix(ts.URL, "http://")+"/ns1/cluster1/0", Options{Namespace: "test", DiscoverReplicas: true})
+	if err != nil {
+		t.Fatalf("NewKvrocksExporter() err: %s", err)
+	}
+	collect := func() map[string]*Exporter {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			e.collectDiscoveredNodes(ch)
+			close(ch)
+		}()
+		for range ch {
+		}
+		return e.discoveredNodes
+	}
+
+	first := collect()
+	second := collect()
+	if len(second) != 2 {
+		t.Fatalf("got %d node exporters, want 2", len(second))
+	}
+	for key, node := range first {
+		if second[key] != node {
+			t.Errorf("exporter of %s was replaced", key)
+		}
+	}
+
+	// the replica left the shard
+	shard = `{"data":{"shard":{"nodes":[{"id":"n1","addr":"127.0.0.1:1","role":"master"}]}}}`
+	if third := collect(); len(third) != 1 || third["master redis://127.0.0.1:1"] != first["master redis://127.0.0.1:1"] {
+		t.Errorf("got node exporters: %v", third)
+	}
+}
@@ -0,0 +1,260 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RocksLabs/kvrocks_exporter/info"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	diskHistoryVersion = 1
+
+	defaultDiskForecastInterval = time.Minute
+	maxDiskHistorySamples       = 1000
+	minDiskForecastSamples      = 6
+
+	// samples further above the trend than this many median absolute deviations are compaction spikes
+	diskSpikeMADs = 3.0
+)
+
+type diskSample struct {
+	Time float64 `json:"t"` // unix seconds
+	Used float64 `json:"used"`
+}
+
+// diskFit is the trend fitted to the samples of an instance up to the sample at last
+type diskFit struct {
+	last      float64
+	samples   int
+	slope     float64
+	intercept float64
+	ok        bool
+}
+
+type diskHistoryFile struct {
+	Version int                     `json:"version"`
+	Targets map[string][]diskSample `json:"targets"`
+}
+
+/*
+diskForecaster keeps the used disk size of the instances, one sample per interval over the window, and predicts
+when the disk is full from the trend of the samples. It's shared by an exporter and the exporters of its targets,
+and is kept in Options.DiskForecastFile so the history survives restarts of the exporter.
+*/
+type diskForecaster struct {
+	sync.Mutex
+	window   time.Duration
+	interval time.Duration
+	path     string
+	history  map[string][]diskSample
+
+	// the fits of the last samples by instance, so they're only fitted again once a sample was added
+	fits map[string]diskFit
+}
+
+func newDiskForecaster(window, interval time.Duration, path string) (*diskForecaster, error) {
+	if interval <= 0 {
+		interval = defaultDiskForecastInterval
+	}
+	// the number of samples is bounded whatever the window
+	if window/interval > maxDiskHistorySamples {
+		interval = window / maxDiskHistorySamples
+	}
+	f := &diskForecaster{window: window, interval: interval, path: path, history: map[string][]diskSample{}, fits: map[string]diskFit{}}
+	if path == "" {
+		return f, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var h diskHistoryFile
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, fmt.Errorf("couldn't decode disk history file %s, err: %s", path, err)
+	}
+	if h.Version != diskHistoryVersion {
+		return nil, fmt.Errorf("unsupported disk history file version %d in %s", h.Version, path)
+	}
+	if h.Targets != nil {
+		f.history = h.Targets
+	}
+	return f, nil
+}
+
+// add records the used disk size of the instance at addr unless the last sample is more recent than the interval,
+// and returns the samples within the window
+func (f *diskForecaster) add(addr string, now time.Time, used float64) []diskSample {
+	f.Lock()
+	defer f.Unlock()
+
+	ts := float64(now.UnixNano()) / 1e9
+	samples := f.history[addr]
+	if n := len(samples); n > 0 && ts-samples[n-1].Time < f.interval.Seconds() && ts >= samples[n-1].Time {
+		return append([]diskSample(nil), samples...)
+	}
+
+	samples = append(samples, diskSample{Time: ts, Used: used})
+	oldest := ts - f.window.Seconds()
+	drop := 0
+	for drop < len(samples) && samples[drop].Time < oldest {
+		drop++
+	}
+	if len(samples)-drop > maxDiskHistorySamples {
+		drop = len(samples) - maxDiskHistorySamples
+	}
+	samples = append([]diskSample(nil), samples[drop:]...)
+	f.history[addr] = samples
+	f.save()
+	return append([]diskSample(nil), samples...)
+}
+
+/*
+trend returns the trend of the samples returned by add for the instance at addr. Fitting is quadratic in the number
+of samples, so the fit is kept until add records another sample rather than done again on every scrape.
+*/
+func (f *diskForecaster) trend(addr string, samples []diskSample) (slope, intercept float64, ok bool) {
+	if len(samples) == 0 {
+		return 0, 0, false
+	}
+	last := samples[len(samples)-1].Time
+
+	f.Lock()
+	fit, cached := f.fits[addr]
+	f.Unlock()
+	if cached && fit.last == last && fit.samples == len(samples) {
+		return fit.slope, fit.intercept, fit.ok
+	}
+
+	slope, intercept, ok = diskTrend(samples)
+	f.Lock()
+	f.fits[addr] = diskFit{last: last, samples: len(samples), slope: slope, intercept: intercept, ok: ok}
+	f.Unlock()
+	return slope, intercept, ok
+}
+
+// save writes the history file, the caller holds the lock
+func (f *diskForecaster) save() {
+	if f.path == "" {
+		return
+	}
+	err := writeFileAtomic(f.path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(diskHistoryFile{Version: diskHistoryVersion, Targets: f.history})
+	})
+	if err != nil {
+		log.Errorf("Couldn't write disk history file %s, err: %s", f.path, err)
+	}
+}
+
+func median(values []float64) float64 {
+	s := append([]float64(nil), values...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// theilSen fits a line through the samples with the median of the slopes between all pairs of samples,
+// which isn't pulled by a few outliers like a least squares fit
+func theilSen(samples []diskSample) (slope, intercept float64, ok bool) {
+	var slopes []float64
+	for i := range samples {
+		for j := i + 1; j < len(samples); j++ {
+			if dt := samples[j].Time - samples[i].Time; dt != 0 {
+				slopes = append(slopes, (samples[j].Used-samples[i].Used)/dt)
+			}
+		}
+	}
+	if len(slopes) == 0 {
+		return 0, 0, false
+	}
+	slope = median(slopes)
+
+	intercepts := make([]float64, len(samples))
+	for i, s := range samples {
+		intercepts[i] = s.Used - slope*s.Time
+	}
+	return slope, median(intercepts), true
+}
+
+/*
+diskTrend fits the trend of the used disk size. Compactions temporarily use extra space, so the samples lying
+more than diskSpikeMADs median absolute deviations above a first fit are dropped before fitting again.
+*/
+func diskTrend(samples []diskSample) (slope, intercept float64, ok bool) {
+	slope, intercept, ok = theilSen(samples)
+	if !ok {
+		return 0, 0, false
+	}
+
+	residuals := make([]float64, len(samples))
+	for i, s := range samples {
+		residuals[i] = s.Used - (slope*s.Time + intercept)
+	}
+	deviations := make([]float64, len(residuals))
+	m := median(residuals)
+	for i, r := range residuals {
+		deviations[i] = math.Abs(r - m)
+	}
+	mad := median(deviations)
+
+	var kept []diskSample
+	for i, s := range samples {
+		if residuals[i]-m <= diskSpikeMADs*mad {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == len(samples) || len(kept) < minDiskForecastSamples {
+		return slope, intercept, true
+	}
+	return theilSen(kept)
+}
+
+/*
+extractDiskForecastMetrics exports the growth rate of the used disk size and the seconds until it reaches the disk
+capacity at that rate. Both need minDiskForecastSamples samples, the prediction is only exported while the disk grows.
+*/
+func (e *Exporter) extractDiskForecastMetrics(ch chan<- prometheus.Metric, snap *info.Snapshot) {
+	used, err := strconv.ParseFloat(snap.Value("used_disk_size"), 64)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	addr := targetLabel(e.kvrocksAddr)
+	samples := e.diskForecast.add(addr, now, used)
+	e.registerConstMetricGauge(ch, "disk_forecast_samples", float64(len(samples)))
+	if len(samples) < minDiskForecastSamples {
+		return
+	}
+
+	slope, intercept, ok := e.diskForecast.trend(addr, samples)
+	if !ok {
+		return
+	}
+	e.registerConstMetricGauge(ch, "disk_growth_bytes_per_second", slope)
+
+	capacity, err := strconv.ParseFloat(snap.Value("disk_capacity"), 64)
+	if err != nil || capacity <= 0 || slope <= 0 {
+		return
+	}
+	ts := float64(now.UnixNano()) / 1e9
+	e.registerConstMetricGauge(ch, "disk_full_predicted_seconds", math.Max(0, (capacity-(slope*ts+intercept))/slope))
+}
@@ -0,0 +1,142 @@
+package exporter
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiskTrend(t *testing.T) {
+	// 1 MB per minute with compaction spikes of 5 GB
+	var samples []diskSample
+	for i := 0; i < 60; i++ {
+		used := 50e9 + float64(i)*1e6
+		if i%10 == 3 || i%10 == 4 {
+			used += 5e9
+		}
+		samples = append(samples, diskSample{Time: 1729245600 + float64(i)*60, Used: used})
+	}
+
+	slope, intercept, ok := diskTrend(samples)
+	if !ok {
+		t.Fatalf("diskTrend() failed")
+	}
+	if want := 1e6 / 60; math.Abs(slope-want) > want*0.01 {
+		t.Errorf("diskTrend() slope got: %v, want: %v", slope, want)
+	}
+	if got := slope*samples[0].Time + intercept; math.Abs(got-50e9) > 1e6 {
+		t.Errorf("diskTrend() at the first sample got: %v, want: %v", got, 50e9)
+	}
+
+	if _, _, ok := diskTrend([]diskSample{{Time: 1, Used: 1}}); ok {
+		t.Errorf("expected no trend for a single sample")
+	}
+}
+
+func TestDiskForecasterTrendCache(t *testing.T) {
+	f, _ := newDiskForecaster(time.Hour, time.Minute, "")
+	start := time.Unix(1729245600, 0)
+	var samples []diskSample
+	for i := 0; i < 10; i++ {
+		samples = f.add("node-1:6666", start.Add(time.Duration(i)*time.Minute), float64(i)*60)
+	}
+	if slope, _, ok := f.trend("node-1:6666", samples); !ok || math.Abs(slope-1) > 1e-9 {
+		t.Fatalf("trend() slope got: %v, want: 1", slope)
+	}
+
+	// no refit until a sample is added
+	fit := f.fits["node-1:6666"]
+	fit.slope = 42
+	f.fits["node-1:6666"] = fit
+	if slope, _, _ := f.trend("node-1:6666", f.add("node-1:6666", start.Add(9*time.Minute+time.Second), 1e9)); slope != 42 {
+		t.Errorf("trend() slope got: %v, want the cached fit", slope)
+	}
+	if slope, _, _ := f.trend("node-1:6666", f.add("node-1:6666", start.Add(10*time.Minute), 600)); math.Abs(slope-1) > 1e-9 {
+		t.Errorf("trend() slope got: %v, want a new fit of 1", slope)
+	}
+}
+
+func TestDiskForecasterHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	f, err := newDiskForecaster(time.Hour, time.Minute, path)
+	if err != nil {
+		t.Fatalf("newDiskForecaster() err: %s", err)
+	}
+
+	start := time.Unix(1729245600, 0)
+	f.add("node-1:6666", start, 1)
+	// more recent than the interval
+	if got := f.add("node-1:6666", start.Add(30*time.Second), 2); len(got) != 1 {
+		t.Errorf("add() got %d samples, want 1", len(got))
+	}
+	for i := 1; i <= 70; i++ {
+		f.add("node-1:6666", start.Add(time.Duration(i)*time.Minute), float64(i))
+	}
+
+	// the history survives a restart of the exporter, without the samples older than the window
+	f, err = newDiskForecaster(time.Hour, time.Minute, path)
+	if err != nil {
+		t.Fatalf("newDiskForecaster() err: %s", err)
+	}
+	got := f.add("node-1:6666", start.Add(71*time.Minute), 71)
+	if len(got) != 61 || got[0].Used != 11 || got[len(got)-1].Used != 71 {
+		t.Errorf("add() got %d samples from %v to %v, want 61 from 11 to 71", len(got), got[0].Used, got[len(got)-1].Used)
+	}
+
+	// the number of samples is bounded whatever the window
+	if f, _ := newDiskForecaster(30*24*time.Hour, time.Second, ""); f.interval != 30*24*time.Hour/maxDiskHistorySamples {
+		t.Errorf("newDiskForecaster() interval got: %s", f.interval)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version": 2}`), 0o600); err != nil {
+		t.Fatalf("couldn't write history file: %s", err)
+	}
+	if _, err := NewKvrocksExporter("localhost:6666", Options{DiskForecastWindow: time.Hour, DiskForecastFile: path}); err == nil {
+		t.Errorf("expected error for an unsupported history file version")
+	}
+}
+
+func TestDiskForecastMetrics(t *testing.T) {
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", DiskForecastWindow: time.Hour})
+
+	// a history growing 1 MB per minute until now, 10 GB below the capacity of the fixture
+	now := time.Now()
+	for i := 10; i > 0; i-- {
+		e.diskForecast.add("localhost:6666", now.Add(-time.Duration(i)*time.Minute), 526870912000-float64(i)*1e6)
+	}
+	infoAll := strings.Replace(loadTestInfo(t), "used_disk_size:61827364512", "used_disk_size:526870912000", 1)
+
+	mfs := gatherInfoMetrics(t, e, infoAll)
+	if got, _ := metricValue(mfs, "test_disk_forecast_samples", nil); got != 11 {
+		t.Errorf("disk_forecast_samples got: %v, want: 11", got)
+	}
+	if got, _ := metricValue(mfs, "test_disk_growth_bytes_per_second", nil); math.Abs(got-1e6/60) > 1 {
+		t.Errorf("disk_growth_bytes_per_second got: %v, want: %v", got, 1e6/60)
+	}
+	want := 10e9 / (1e6 / 60)
+	if got, ok := metricValue(mfs, "test_disk_full_predicted_seconds", nil); !ok || math.Abs(got-want) > want*0.01 {
+		t.Errorf("disk_full_predicted_seconds got: %v, want: %v", got, want)
+	}
+
+	// nothing is predicted for a disk that doesn't grow
+	e, _ = NewKvrocksExporter("localhost:6666", Options{Namespace: "test", DiskForecastWindow: time.Hour})
+	for i := 10; i > 0; i-- {
+		e.diskForecast.add("localhost:6666", now.Add(-time.Duration(i)*time.Minute), 61827364512+float64(i)*1e6)
+	}
+	mfs = gatherInfoMetrics(t, e, loadTestInfo(t))
+	if got, _ := metricValue(mfs, "test_disk_growth_bytes_per_second", nil); got >= 0 {
+		t.Errorf("disk_growth_bytes_per_second got: %v, want a negative rate", got)
+	}
+	if _, ok := mfs["test_disk_full_predicted_seconds"]; ok {
+		t.Errorf("disk_full_predicted_seconds shouldn't be exported for a shrinking disk")
+	}
+
+	// off by default
+	e, _ = NewKvrocksExporter("localhost:6666", Options{Namespace: "test"})
+	if _, ok := gatherInfoMetrics(t, e, loadTestInfo(t))["test_disk_forecast_samples"]; ok {
+		t.Errorf("disk_forecast_samples shouldn't be exported without DiskForecastWindow")
+	}
+}
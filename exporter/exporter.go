@@ -3,6 +3,7 @@ package exporter
 import (
 	"fmt"
 	"net/http"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -33,11 +34,38 @@ type Exporter struct {
 
 	metricDescriptions map[string]*prometheus.Desc
 
+	// nil unless Options.BigKeysScanBudget is set
+	bigKeys *bigKeySampler
+	// nil unless Options.KeyspaceSampleBudget is set
+	keyspace *keyspaceSampler
+
+	// scripts of Options.LuaScripts, sorted by name
+	scripts []luaScript
+
+	// commands of Options.CustomCommands
+	customCommands []*customCommand
+
+	// restarts, role and master changes, backups and slot migrations, shared with the exporters of the targets
+	changes *changeTracker
+	// nil unless Options.DiskForecastWindow is set, shared with the exporters of the targets
+	diskForecast *diskForecaster
+
+	// set once the server answered FT._LIST with an unknown command error
+	searchUnsupported bool
+
+	// exporters of Options.Targets, scraped on every Collect
+	targets []*Exporter
+	// exporters of the nodes behind a discovery target by role and address, replaced on every discovery
+	discoveredNodes map[string]*Exporter
+
 	options Options
 
 	metricMapCounters map[string]string
 	metricMapGauges   map[string]string
 
+	infoFieldsInclude *regexp.Regexp
+	infoFieldsExclude *regexp.Regexp
+
 	mux *http.ServeMux
 
 	buildInfo BuildInfo
@@ -60,6 +88,39 @@ type Options struct {
 	MetricsPath           string
 	KvrocksMetricsOnly    bool
 	PingOnConnect         bool
+	DiscoverReplicas      bool
+	ControllerAddr        string
+	ExportAllInfoFields   bool
+	InfoFieldsInclude     string
+	InfoFieldsExclude     string
+	MetricNaming          string
+	ClusterScrapeWorkers  int
+	Targets               []string
+	TargetScrapeWorkers   int
+	CheckStreams          string
+	MaxStreamKeys         int
+	CheckSearchIndexes    bool
+	CheckBloomFilters     string
+	CheckHyperLogLogs     string
+	BigKeysScanBudget     int
+	BigKeysTopK           int
+	KeyspaceSampleBudget  int
+	KeyspaceDelimiter     string
+	KeyspacePrefixDepth   int
+	KeyspacePrefixRegex   string
+	KeyspaceMaxPrefixes   int
+	LuaScripts            map[string][]byte
+	ScriptTimeout         time.Duration
+	CustomCommands        []CommandConfig
+	StateFile             string
+	Notifiers             []Notifier
+	DerivedRatios         bool
+	DiskForecastWindow    time.Duration
+	DiskForecastInterval  time.Duration
+	DiskForecastFile      string
+	LegacyWriteStalls     bool
+	ConstLabels           prometheus.Labels
+	ReplayBundle          *CaptureBundle
 	Registry              *prometheus.Registry
 	BuildInfo             BuildInfo
 }
@@ -68,6 +129,14 @@ type Options struct {
 func NewKvrocksExporter(kvrocksURI string, opts Options) (*Exporter, error) {
 	log.Debugf("NewKvrocksExporter options: %#v", opts)
 
+	if isDiscoveryURI(kvrocksURI) {
+		service, err := discoveryService(kvrocksURI)
+		if err != nil {
+			return nil, err
+		}
+		opts.ConstLabels = mergeLabels(opts.ConstLabels, prometheus.Labels{"service": service})
+	}
+
 	e := &Exporter{
 		kvrocksAddr: kvrocksURI,
 		options:     opts,
@@ -76,21 +145,24 @@ func NewKvrocksExporter(kvrocksURI string, opts Options) (*Exporter, error) {
 		buildInfo: opts.BuildInfo,
 
 		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
-			Namespace: opts.Namespace,
-			Name:      "exporter_scrapes_total",
-			Help:      "Current total kvrocks scrapes.",
+			Namespace:   opts.Namespace,
+			Name:        "exporter_scrapes_total",
+			Help:        "Current total kvrocks scrapes.",
+			ConstLabels: opts.ConstLabels,
 		}),
 
 		scrapeDuration: prometheus.NewSummary(prometheus.SummaryOpts{
-			Namespace: opts.Namespace,
-			Name:      "exporter_scrape_duration_seconds",
-			Help:      "Durations of scrapes by the exporter",
+			Namespace:   opts.Namespace,
+			Name:        "exporter_scrape_duration_seconds",
+			Help:        "Durations of scrapes by the exporter",
+			ConstLabels: opts.ConstLabels,
 		}),
 
 		targetScrapeRequestErrors: prometheus.NewCounter(prometheus.CounterOpts{
-			Namespace: opts.Namespace,
-			Name:      "target_scrape_request_errors_total",
-			Help:      "Errors in requests to the exporter",
+			Namespace:   opts.Namespace,
+			Name:        "target_scrape_request_errors_total",
+			Help:        "Errors in requests to the exporter",
+			ConstLabels: opts.ConstLabels,
 		}),
 
 		metricMapGauges: map[string]string{
@@ -184,42 +256,204 @@ func NewKvrocksExporter(kvrocksURI string, opts Options) (*Exporter, error) {
 
 	e.metricMapGauges["total_system_memory"] = "total_system_memory_bytes"
 
+	if err := validateMetricNaming(e.options.MetricNaming); err != nil {
+		return nil, err
+	}
+
+	if e.options.InfoFieldsInclude != "" {
+		re, err := regexp.Compile(e.options.InfoFieldsInclude)
+		if err != nil {
+			return nil, fmt.Errorf("invalid info fields include regex %q: %s", e.options.InfoFieldsInclude, err)
+		}
+		e.infoFieldsInclude = re
+	}
+	if e.options.InfoFieldsExclude != "" {
+		re, err := regexp.Compile(e.options.InfoFieldsExclude)
+		if err != nil {
+			return nil, fmt.Errorf("invalid info fields exclude regex %q: %s", e.options.InfoFieldsExclude, err)
+		}
+		e.infoFieldsExclude = re
+	}
+
 	e.metricDescriptions = map[string]*prometheus.Desc{}
 
 	for k, desc := range map[string]struct {
 		txt  string
 		lbls []string
 	}{
+		"backup_dir_info":                      {txt: "Directory BGSAVE writes the backups of the instance to", lbls: []string{"dir"}},
+		"backup_in_progress":                   {txt: "Whether a backup of the instance is running"},
+		"backup_in_progress_seconds":           {txt: "Seconds since the exporter first saw the running backup"},
+		"big_key_disk_usage_bytes":             {txt: "Disk usage of the biggest keys found by the big key sampler, by type", lbls: []string{"key", "type"}},
+		"big_key_size":                         {txt: "Size of the biggest keys found by the big key sampler, in bytes for strings and elements otherwise", lbls: []string{"key", "type"}},
+		"big_keys_sampled_keys":                {txt: "Number of keys sampled in the walk through the keyspace the big keys are from"},
+		"big_keys_scan_passes_total":           {txt: "Number of complete walks through the keyspace of the big key sampler"},
+		"block_cache_hit_ratio":                {txt: "Block cache hits per lookup since the start of the instance, overall and by block type", lbls: []string{"type"}},
+		"bloom_filter_capacity":                {txt: "Number of items the bloom filter can hold at its error rate", lbls: []string{"key"}},
+		"bloom_filter_expansion_rate":          {txt: "Growth factor of the sub-filters added once the bloom filter is full", lbls: []string{"key"}},
+		"bloom_filter_fill_ratio":              {txt: "Number of items inserted into the bloom filter per capacity", lbls: []string{"key"}},
+		"bloom_filter_filters":                 {txt: "Number of sub-filters of the bloom filter", lbls: []string{"key"}},
+		"bloom_filter_items_inserted":          {txt: "Number of items inserted into the bloom filter", lbls: []string{"key"}},
+		"bloom_filter_size_bytes":              {txt: "Memory used by the bloom filter", lbls: []string{"key"}},
+		"clients_utilization_ratio":            {txt: "Connected clients per maxclients"},
+		"cluster_masters_without_replicas":     {txt: "Number of masters of the cluster without a healthy replica"},
+		"cluster_migrating_slot":               {txt: "Slot currently being migrated away from this node", lbls: []string{"source_node", "destination_node"}},
+		"cluster_migrating_state":              {txt: "State of the current slot migration of this node", lbls: []string{"state"}},
+		"cluster_nodes":                        {txt: "Number of nodes of the cluster as reported by CLUSTER NODES of the seed"},
+		"cluster_nodes_up":                     {txt: "Number of nodes of the cluster that could be scraped"},
+		"cluster_slot_migrations_total":        {txt: "Slot migrations observed to finish between scrapes, by result", lbls: []string{"result"}},
+		"cluster_slots_covered":                {txt: "Number of slots served by a master that isn't failing"},
 		"commands_duration_seconds_bucket":     {txt: `Histogram of the amount of time in seconds spent per command`, lbls: []string{"cmd"}},
 		"commands_duration_seconds_total":      {txt: `Total amount of time in seconds spent per command`, lbls: []string{"cmd"}},
 		"commands_total":                       {txt: `Total number of calls per command`, lbls: []string{"cmd"}},
+		"controller_cluster_migrating_shards":  {txt: "Number of shards of a cluster currently migrating a slot", lbls: []string{"namespace", "cluster"}},
+		"controller_cluster_shards":            {txt: "Number of shards of a cluster managed by the kvrocks-controller", lbls: []string{"namespace", "cluster"}},
+		"controller_cluster_version":           {txt: "Topology version of a cluster managed by the kvrocks-controller", lbls: []string{"namespace", "cluster"}},
+		"controller_leader_info":               {txt: "Address of the current kvrocks-controller leader", lbls: []string{"leader"}},
+		"controller_shard_importing_slot":      {txt: "Slot currently being imported into the shard, -1 if none", lbls: []string{"namespace", "cluster", "shard"}},
+		"controller_shard_migrating":           {txt: "Whether the shard is currently migrating a slot", lbls: []string{"namespace", "cluster", "shard"}},
+		"controller_shard_migrating_slot":      {txt: "Slot currently being migrated out of the shard, -1 if none", lbls: []string{"namespace", "cluster", "shard"}},
+		"controller_shard_migration_target":    {txt: "Index of the shard the slot is migrated to, -1 if none", lbls: []string{"namespace", "cluster", "shard"}},
+		"controller_shard_node_info":           {txt: "Nodes of a shard as known by the kvrocks-controller", lbls: []string{"namespace", "cluster", "shard", "node_id", "addr", "role"}},
+		"controller_shard_nodes":               {txt: "Number of nodes of a shard", lbls: []string{"namespace", "cluster", "shard"}},
+		"controller_shard_slot_range":          {txt: "Slot ranges served by a shard", lbls: []string{"namespace", "cluster", "shard", "start", "end"}},
+		"controller_shard_slots":               {txt: "Number of slots served by a shard", lbls: []string{"namespace", "cluster", "shard"}},
+		"controller_up":                        {txt: "Whether the kvrocks-controller API could be queried"},
 		"connected_slave_lag_seconds":          {txt: "Lag of connected slave", lbls: []string{"slave_ip", "slave_port", "slave_state"}},
 		"connected_slave_offset_bytes":         {txt: "Offset of connected slave", lbls: []string{"slave_ip", "slave_port", "slave_state"}},
+		"custom_command_success":               {txt: "Whether the runs of a command of the config file succeeded", lbls: []string{"name"}},
 		"db_avg_ttl_seconds":                   {txt: "Avg TTL in seconds", lbls: []string{"db"}},
 		"db_keys":                              {txt: "Total number of keys by DB", lbls: []string{"db"}},
 		"db_keys_expiring":                     {txt: "Total number of expiring keys by DB", lbls: []string{"db"}},
 		"db_keys_expired":                      {txt: "Total number of expired keys by DB", lbls: []string{"db"}},
+		"db_size_utilization_ratio":            {txt: "Used db size per max_db_size"},
+		"disk_forecast_samples":                {txt: "Number of used disk size samples the disk full forecast is based on"},
+		"disk_full_predicted_seconds":          {txt: "Seconds until the used disk size reaches the disk capacity at its current growth rate"},
+		"disk_growth_bytes_per_second":         {txt: "Growth rate of the used disk size, without the temporary growth of compactions"},
+		"disk_utilization_ratio":               {txt: "Used disk size per disk capacity"},
+		"discovery_master_info":                {txt: "Address of the master currently resolved for a sentinel or controller target", lbls: []string{"addr"}},
 		"exporter_last_scrape_error":           {txt: "The last scrape error status.", lbls: []string{"err"}},
+		"hyperloglog_cardinality":              {txt: "Cardinality of the HyperLogLog as estimated by PFCOUNT", lbls: []string{"key"}},
 		"instance_info":                        {txt: "Information about the kvrocks instance", lbls: []string{"role", "version", "git_sha1", "os", "tcp_port", "gcc_version", "process_id"}},
+		"keyspace_hit_ratio":                   {txt: "Key lookups that found the key per lookup since the start of the instance"},
+		"keyspace_prefix_expiring_ratio":       {txt: "Share of the sampled keys of a prefix that expire", lbls: []string{"prefix"}},
+		"keyspace_prefix_keys_estimated":       {txt: "Number of keys of a prefix and type estimated from the sampled keys", lbls: []string{"prefix", "type"}},
+		"keyspace_prefix_ttl_seconds":          {txt: "Histogram of the remaining time to live of the sampled keys of a prefix that expire", lbls: []string{"prefix"}},
+		"keyspace_sampled_keys":                {txt: "Number of keys sampled in the walk through the keyspace the prefix metrics are from"},
+		"last_backup_duration_seconds":         {txt: "Time the last backup took in seconds"},
+		"last_backup_success":                  {txt: "Whether the last backup succeeded, 1 for a last_bgsave_status of ok and 0 for err"},
+		"last_backup_timestamp_seconds":        {txt: "When the last backup started"},
+		"last_master_change_timestamp_seconds": {txt: "When the exporter saw the replica follow another master"},
+		"last_restart_timestamp_seconds":       {txt: "When the exporter saw the instance restart"},
+		"last_role_change_timestamp_seconds":   {txt: "When the exporter saw the role of the instance change"},
 		"last_slow_execution_duration_seconds": {txt: `The amount of time needed for last slow execution, in seconds`},
+		"last_successful_backup_age_seconds":   {txt: "Seconds since the last successful backup seen by the exporter started"},
 		"latency_spike_last":                   {txt: `When the latency spike last occurred`, lbls: []string{"event_name"}},
 		"latency_spike_duration_seconds":       {txt: `Length of the last latency spike in seconds`, lbls: []string{"event_name"}},
+		"master_changes_total":                 {txt: "Number of times the exporter saw the replica follow another master"},
 		"master_link_up":                       {txt: "Master link status on Kvrocks slave", lbls: []string{"master_host", "master_port"}},
 		"master_sync_in_progress":              {txt: "Master sync in progress", lbls: []string{"master_host", "master_port"}},
 		"master_last_io_seconds_ago":           {txt: "Master last io seconds ago", lbls: []string{"master_host", "master_port"}},
+		"restarts_detected_total":              {txt: "Number of restarts of the instance seen by the exporter, by a changed run id or a later start time"},
+		"role_changes_total":                   {txt: "Number of role changes of the instance seen by the exporter", lbls: []string{"from", "to"}},
+		"sampled_key_size":                     {txt: "Histogram of the sizes of the keys sampled by the big key sampler, in bytes for strings and elements otherwise", lbls: []string{"type"}},
+		"script_duration_seconds":              {txt: "Time it took to run a Lua script", lbls: []string{"script"}},
+		"script_success":                       {txt: "Whether a Lua script ran and returned valid name/value pairs", lbls: []string{"script"}},
+		"search_index_documents":               {txt: "Number of documents in a search index", lbls: []string{"index"}},
+		"search_index_fields":                  {txt: "Number of fields of a search index", lbls: []string{"index"}},
+		"search_index_indexed_ratio":           {txt: "Ratio of the documents already indexed by a search index", lbls: []string{"index"}},
+		"search_index_indexing":                {txt: "Whether a search index is currently indexing documents", lbls: []string{"index"}},
+		"search_index_indexing_failures":       {txt: "Number of documents that failed to be indexed by a search index", lbls: []string{"index"}},
+		"search_indexes":                       {txt: "Number of search indexes"},
 		"slave_repl_offset":                    {txt: "Slave replication offset", lbls: []string{"master_host", "master_port"}},
 		"slave_info":                           {txt: "Information about the Kvrocks slave", lbls: []string{"master_host", "master_port", "read_only"}},
 		"slowlog_last_id":                      {txt: `Last id of slowlog`},
 		"slowlog_length":                       {txt: `Total slowlog`},
 		"start_time_seconds":                   {txt: "Start time of the kvrocks instance since unix epoch in seconds."},
 		"up":                                   {txt: "Information about the kvrocks instance"},
+		"write_stalled":                        {txt: "Whether the write stall counter went up since the last scrape", lbls: []string{"cause", "kind", "column_family"}},
+		"write_stalls_total":                   {txt: "Number of RocksDB write stalls, by cause, kind (slowdown or stop) and column family", lbls: []string{"cause", "kind", "column_family"}},
 
 		"index_and_filter_cache_usage": {txt: `The number of bytes used by the index and filter block cache`, lbls: []string{"column_family"}},
 		"block_cache_pinned_usage":     {txt: `The number of bytes used by the pinned block cache`, lbls: []string{"column_family"}},
 		"block_cache_usage":            {txt: `The number of bytes used by the data block cache`, lbls: []string{"column_family"}},
 		"estimate_keys":                {txt: `The estimate keys`, lbls: []string{"column_family"}},
+
+		"stream_consumer_idle_seconds":               {txt: "Time since the consumer of a stream group last read from the stream", lbls: []string{"stream", "group", "consumer"}},
+		"stream_consumer_pending":                    {txt: "Messages delivered to the consumer of a stream group but not yet acknowledged", lbls: []string{"stream", "group", "consumer"}},
+		"stream_group_consumers":                     {txt: "Number of consumers of a stream group", lbls: []string{"stream", "group"}},
+		"stream_group_lag":                           {txt: "Number of entries of the stream not yet delivered to the group", lbls: []string{"stream", "group"}},
+		"stream_group_last_delivered_id_age_seconds": {txt: "Age of the last entry delivered to the group", lbls: []string{"stream", "group"}},
+		"stream_group_pending":                       {txt: "Messages delivered to a stream group but not yet acknowledged", lbls: []string{"stream", "group"}},
+		"stream_groups":                              {txt: "Number of consumer groups of a stream", lbls: []string{"stream"}},
+		"stream_keys_truncated":                      {txt: "Whether more stream keys matched the patterns than are exported"},
+		"stream_last_generated_id_timestamp_seconds": {txt: "Timestamp of the last entry added to the stream", lbls: []string{"stream"}},
+		"stream_length":                              {txt: "Number of entries of a stream", lbls: []string{"stream"}},
 	} {
-		e.metricDescriptions[k] = newMetricDescr(opts.Namespace, k, desc.txt, desc.lbls)
+		e.metricDescriptions[k] = newMetricDescr(opts.Namespace, k, desc.txt, desc.lbls, opts.ConstLabels)
+	}
+
+	// descriptors of the INFO fields are built once instead of on every scrape
+	if e.legacyNaming() {
+		for _, m := range []map[string]string{e.metricMapGauges, e.metricMapCounters} {
+			for _, v := range m {
+				if _, ok := e.metricDescriptions[v]; !ok {
+					e.metricDescriptions[v] = newMetricDescr(opts.Namespace, v, v+" metric", nil, opts.ConstLabels)
+				}
+			}
+		}
+	}
+
+	if e.v2Naming() {
+		for _, def := range v2InfoMetrics {
+			e.metricDescriptions[def.name] = newMetricDescr(opts.Namespace, def.name, def.help, nil, opts.ConstLabels)
+		}
+	}
+
+	e.scripts = newLuaScripts(opts.LuaScripts)
+
+	customCommands, err := e.newCustomCommands(opts.CustomCommands)
+	if err != nil {
+		return nil, err
+	}
+	e.customCommands = customCommands
+
+	if opts.BigKeysScanBudget > 0 {
+		e.bigKeys = newBigKeySampler()
+	}
+
+	if opts.KeyspaceSampleBudget > 0 {
+		var re *regexp.Regexp
+		if opts.KeyspacePrefixRegex != "" {
+			var err error
+			if re, err = regexp.Compile(opts.KeyspacePrefixRegex); err != nil {
+				return nil, fmt.Errorf("invalid keyspace prefix regex %q: %s", opts.KeyspacePrefixRegex, err)
+			}
+		}
+		e.keyspace = newKeyspaceSampler(re)
+	}
+
+	if e.changes, err = newChangeTracker(opts.StateFile); err != nil {
+		return nil, err
+	}
+
+	if opts.DiskForecastWindow > 0 {
+		if e.diskForecast, err = newDiskForecaster(opts.DiskForecastWindow, opts.DiskForecastInterval, opts.DiskForecastFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, addr := range opts.Targets {
+		targetOpts := opts
+		targetOpts.Targets = nil
+		targetOpts.Registry = nil
+		targetOpts.ControllerAddr = ""
+		targetOpts.ConstLabels = mergeLabels(opts.ConstLabels, prometheus.Labels{"target": targetLabel(addr)})
+		t, err := e.newChildExporter(addr, targetOpts)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", targetLabel(addr), err)
+		}
+		e.targets = append(e.targets, t)
 	}
 
 	if e.options.MetricsPath == "" {
@@ -247,25 +481,32 @@ func NewKvrocksExporter(kvrocksURI string, opts Options) (*Exporter, error) {
 
 	e.mux.HandleFunc("/", e.indexHandler)
 	e.mux.HandleFunc("/scrape", e.scrapeHandler)
+	e.mux.HandleFunc("/scrape_cluster", e.scrapeClusterHandler)
 	e.mux.HandleFunc("/health", e.healthHandler)
 
 	return e, nil
 }
 
+// newChildExporter returns an exporter for a target, node or instance behind e,
+// which keeps track of restarts, role changes and the disk history together with e
+func (e *Exporter) newChildExporter(kvrocksURI string, opts Options) (*Exporter, error) {
+	opts.StateFile = ""
+	opts.DiskForecastFile = ""
+	child, err := NewKvrocksExporter(kvrocksURI, opts)
+	if err != nil {
+		return nil, err
+	}
+	child.changes = e.changes
+	child.diskForecast = e.diskForecast
+	return child, nil
+}
+
 // Describe outputs Redis metric descriptions.
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	for _, desc := range e.metricDescriptions {
 		ch <- desc
 	}
 
-	for _, v := range e.metricMapGauges {
-		ch <- newMetricDescr(e.options.Namespace, v, v+" metric", nil)
-	}
-
-	for _, v := range e.metricMapCounters {
-		ch <- newMetricDescr(e.options.Namespace, v, v+" metric", nil)
-	}
-
 	ch <- e.totalScrapes.Desc()
 	ch <- e.scrapeDuration.Desc()
 	ch <- e.targetScrapeRequestErrors.Desc()
@@ -278,20 +519,15 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	e.totalScrapes.Inc()
 
 	if e.kvrocksAddr != "" {
-		startTime := time.Now()
-		var up float64
-		if err := e.scrapeKvrocksHost(ch); err != nil {
-			e.registerConstMetricGauge(ch, "exporter_last_scrape_error", 1.0, fmt.Sprintf("%s", err))
-		} else {
-			up = 1
-			e.registerConstMetricGauge(ch, "exporter_last_scrape_error", 0, "")
-		}
+		e.collectKvrocks(ch)
+	}
 
-		e.registerConstMetricGauge(ch, "up", up)
+	if len(e.targets) > 0 {
+		e.collectTargets(ch)
+	}
 
-		took := time.Since(startTime).Seconds()
-		e.scrapeDuration.Observe(took)
-		e.registerConstMetricGauge(ch, "exporter_last_scrape_duration_seconds", took)
+	if e.options.ControllerAddr != "" {
+		e.extractControllerMetrics(ch)
 	}
 
 	ch <- e.totalScrapes
@@ -299,6 +535,35 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	ch <- e.targetScrapeRequestErrors
 }
 
+// collectKvrocks scrapes e.kvrocksAddr, or the nodes behind it for a sentinel:// or controller:// address
+func (e *Exporter) collectKvrocks(ch chan<- prometheus.Metric) {
+	if isDiscoveryURI(e.kvrocksAddr) {
+		e.collectDiscoveredNodes(ch)
+	} else {
+		e.collectTarget(ch)
+	}
+}
+
+// collectTarget scrapes e.kvrocksAddr and reports up, scrape error and duration for it.
+// It returns whether the target is up.
+func (e *Exporter) collectTarget(ch chan<- prometheus.Metric) bool {
+	startTime := time.Now()
+	var up float64
+	if err := e.scrapeKvrocksHost(ch); err != nil {
+		e.registerConstMetricGauge(ch, "exporter_last_scrape_error", 1.0, fmt.Sprintf("%s", err))
+	} else {
+		up = 1
+		e.registerConstMetricGauge(ch, "exporter_last_scrape_error", 0, "")
+	}
+
+	e.registerConstMetricGauge(ch, "up", up)
+
+	took := time.Since(startTime).Seconds()
+	e.scrapeDuration.Observe(took)
+	e.registerConstMetricGauge(ch, "exporter_last_scrape_duration_seconds", took)
+	return up == 1
+}
+
 func (e *Exporter) extractConfigMetrics(ch chan<- prometheus.Metric, config []string) (dbCount int, err error) {
 	if len(config)%2 != 0 {
 		return 0, fmt.Errorf("invalid config: %#v", config)
@@ -307,9 +572,15 @@ func (e *Exporter) extractConfigMetrics(ch chan<- prometheus.Metric, config []st
 	for pos := 0; pos < len(config)/2; pos++ {
 		strKey := config[pos*2]
 		strVal := config[pos*2+1]
+		if strKey == "backup-dir" {
+			e.registerConstMetricGauge(ch, "backup_dir_info", 1, strVal)
+			continue
+		}
 		// todo: we can add more configs to this map if there's interest
 		if !map[string]bool{
-			"maxclients": true,
+			"maxclients":            true,
+			"max-backup-to-keep":    true,
+			"max-backup-keep-hours": true,
 		}[strKey] {
 			continue
 		}
@@ -380,6 +651,42 @@ func (e *Exporter) scrapeKvrocksHost(ch chan<- prometheus.Metric) error {
 	}
 	e.extractInfoMetrics(ch, infoAll, 1)
 	log.Debugf("Kvrocks INFO ALL result: [%#v]", infoAll)
+
+	if e.options.IsCluster {
+		e.extractClusterInfoMetrics(ch, c)
+	}
 	e.extractSlowLogMetrics(ch, c)
+
+	if e.options.CheckStreams != "" {
+		e.extractStreamMetrics(ch, c)
+	}
+
+	if e.options.CheckSearchIndexes {
+		e.extractSearchMetrics(ch, c)
+	}
+
+	if e.options.CheckBloomFilters != "" {
+		e.extractBloomFilterMetrics(ch, c)
+	}
+
+	if e.options.CheckHyperLogLogs != "" {
+		e.extractHyperLogLogMetrics(ch, c)
+	}
+
+	if e.bigKeys != nil {
+		e.extractBigKeyMetrics(ch, c)
+	}
+
+	if e.keyspace != nil {
+		e.extractKeyspaceSampleMetrics(ch, c)
+	}
+
+	if len(e.customCommands) > 0 {
+		e.extractCustomCommandMetrics(ch, c)
+	}
+
+	if len(e.scripts) > 0 {
+		e.extractLuaScriptMetrics(ch)
+	}
 	return nil
 }
@@ -29,12 +29,12 @@ func (e *Exporter) indexHandler(w http.ResponseWriter, r *http.Request) {
 `))
 }
 
-func (e *Exporter) scrapeHandler(w http.ResponseWriter, r *http.Request) {
-	target := r.URL.Query().Get("target")
+// scrapeTarget returns the URI in the query parameter param without the username and password,
+// so users don't send them in plain text via http
+func scrapeTarget(r *http.Request, param string) (string, error) {
+	target := r.URL.Query().Get(param)
 	if target == "" {
-		http.Error(w, "'target' parameter must be specified", http.StatusBadRequest)
-		e.targetScrapeRequestErrors.Inc()
-		return
+		return "", fmt.Errorf("'%s' parameter must be specified", param)
 	}
 
 	if !strings.Contains(target, "://") {
@@ -43,27 +43,69 @@ func (e *Exporter) scrapeHandler(w http.ResponseWriter, r *http.Request) {
 
 	u, err := url.Parse(target)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid 'target' parameter, parse err: %ck ", err), http.StatusBadRequest)
-		e.targetScrapeRequestErrors.Inc()
-		return
+		return "", fmt.Errorf("Invalid '%s' parameter, parse err: %s ", param, err)
 	}
 
-	// get rid of username/password info in "target" so users don't send them in plain text via http
 	u.User = nil
-	target = u.String()
+	return u.String(), nil
+}
+
+func (e *Exporter) scrapeHandler(w http.ResponseWriter, r *http.Request) {
+	target, err := scrapeTarget(r, "target")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		e.targetScrapeRequestErrors.Inc()
+		return
+	}
 
 	opts := e.options
+	// the samplers need to keep their cursor between scrapes
+	opts.BigKeysScanBudget = 0
+	opts.KeyspaceSampleBudget = 0
+	// the controller and the targets are only scraped on the metrics path
+	opts.ControllerAddr = ""
+	opts.Targets = nil
 
 	registry := prometheus.NewRegistry()
 	opts.Registry = registry
 
-	_, err = NewKvrocksExporter(target, opts)
+	_, err = e.newChildExporter(target, opts)
+	if err != nil {
+		http.Error(w, "NewKvrocksExporter() err: err", http.StatusBadRequest)
+		e.targetScrapeRequestErrors.Inc()
+		return
+	}
+
+	promhttp.HandlerFor(
+		registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError},
+	).ServeHTTP(w, r)
+}
+
+// scrapeClusterHandler scrapes all nodes of the cluster of the "seed" node
+func (e *Exporter) scrapeClusterHandler(w http.ResponseWriter, r *http.Request) {
+	seed, err := scrapeTarget(r, "seed")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		e.targetScrapeRequestErrors.Inc()
+		return
+	}
+
+	opts := e.options
+	opts.Registry = nil
+	opts.BigKeysScanBudget = 0
+	opts.KeyspaceSampleBudget = 0
+	opts.Targets = nil
+
+	seedExporter, err := e.newChildExporter(seed, opts)
 	if err != nil {
 		http.Error(w, "NewKvrocksExporter() err: err", http.StatusBadRequest)
 		e.targetScrapeRequestErrors.Inc()
 		return
 	}
 
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(clusterCollector{e: seedExporter})
+
 	promhttp.HandlerFor(
 		registry, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError},
 	).ServeHTTP(w, r)
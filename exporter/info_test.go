@@ -1,91 +1,17 @@
 package exporter
 
 import (
-	"fmt"
-	"math"
 	"net/http/httptest"
 	"os"
-	"reflect"
 	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	log "github.com/sirupsen/logrus"
 )
 
-func TestKeyspaceStringParser(t *testing.T) {
-	tsts := []struct {
-		db                                     string
-		stats                                  string
-		keysTotal, keysEx, avgTTL, keysExpired float64
-		ok                                     bool
-	}{
-		{db: "xxx", stats: "", ok: false},
-		{db: "xxx", stats: "keys=1,expires=0,avg_ttl=0", ok: false},
-		{db: "db0", stats: "xxx", ok: false},
-		{db: "db1", stats: "keys=abcd,expires=0,avg_ttl=0", ok: false},
-		{db: "db2", stats: "keys=1234=1234,expires=0,avg_ttl=0", ok: false},
-
-		{db: "db3", stats: "keys=abcde,expires=0", ok: false},
-		{db: "db3", stats: "keys=213,expires=xxx", ok: false},
-		{db: "db3", stats: "keys=123,expires=0,avg_ttl=zzz", ok: false},
-		{db: "db0", stats: "keys=22113592,expires=21683101,avg_ttl=3816396,expired=340250", keysTotal: 22113592, keysEx: 21683101, avgTTL: 3816.396, keysExpired: 340250, ok: true},
-		{db: "db0", stats: "keys=1,expires=0,avg_ttl=0", keysTotal: 1, keysEx: 0, avgTTL: 0, keysExpired: 0, ok: true},
-	}
-
-	for _, tst := range tsts {
-		if kt, kx, ttl, kexp, ok := parseDBKeyspaceString(tst.db, tst.stats); true {
-
-			if ok != tst.ok {
-				t.Errorf("failed for: db:%s stats:%s", tst.db, tst.stats)
-				continue
-			}
-
-			if ok && (kt != tst.keysTotal || kx != tst.keysEx || ttl != tst.avgTTL || kexp != tst.keysExpired) {
-				t.Errorf("values not matching, db:%s stats:%s   %f %f %f %f", tst.db, tst.stats, kt, kx, ttl, kexp)
-			}
-		}
-	}
-}
-
-type slaveData struct {
-	k, v            string
-	ip, state, port string
-	offset          float64
-	lag             float64
-	ok              bool
-}
-
-func TestParseConnectedSlaveString(t *testing.T) {
-	tsts := []slaveData{
-		{k: "slave0", v: "ip=10.254.11.1,port=6379,state=online,offset=1751844676,lag=0", offset: 1751844676, ip: "10.254.11.1", port: "6379", state: "online", ok: true, lag: 0},
-		{k: "slave0", v: "ip=2a00:1450:400e:808::200e,port=6379,state=online,offset=1751844676,lag=0", offset: 1751844676, ip: "2a00:1450:400e:808::200e", port: "6379", state: "online", ok: true, lag: 0},
-		{k: "slave1", v: "offset=1,lag=0", offset: 1, ok: true},
-		{k: "slave1", v: "offset=1", offset: 1, ok: true, lag: -1},
-		{k: "slave2", v: "ip=1.2.3.4,state=online,offset=123,lag=42", offset: 123, ip: "1.2.3.4", state: "online", ok: true, lag: 42},
-
-		{k: "slave", v: "offset=1751844676,lag=0", ok: false},
-		{k: "slaveA", v: "offset=1751844676,lag=0", ok: false},
-		{k: "slave0", v: "offset=abc,lag=0", ok: false},
-		{k: "slave0", v: "offset=0,lag=abc", ok: false},
-	}
-
-	for _, tst := range tsts {
-		t.Run(fmt.Sprintf("%s---%s", tst.k, tst.v), func(t *testing.T) {
-			offset, ip, port, state, lag, ok := parseConnectedSlaveString(tst.k, tst.v)
-
-			if ok != tst.ok {
-				t.Errorf("failed for: db:%s stats:%s", tst.k, tst.v)
-				return
-			}
-			if offset != tst.offset || ip != tst.ip || port != tst.port || state != tst.state || lag != tst.lag {
-				t.Errorf("values not matching, string:%s %f %s %s %s %f", tst.v, offset, ip, port, state, lag)
-			}
-		})
-	}
-}
-
 func TestCommandStats(t *testing.T) {
 	e := getTestExporter()
 
@@ -183,253 +109,188 @@ func TestClusterSlave(t *testing.T) {
 	}
 }
 
-func TestParseCommandStats(t *testing.T) {
-
-	for _, tst := range []struct {
-		fieldKey   string
-		fieldValue string
-
-		wantSuccess   bool
-		wantCmd       string
-		wantCalls     float64
-		wantUsecTotal float64
-	}{
-		{
-			fieldKey:      "cmdstat_get",
-			fieldValue:    "calls=21,usec=175,usec_per_call=8.33",
-			wantSuccess:   true,
-			wantCmd:       "get",
-			wantCalls:     21,
-			wantUsecTotal: 175,
-		},
-		{
-			fieldKey:      "cmdstat_georadius_ro",
-			fieldValue:    "calls=75,usec=1260,usec_per_call=16.80",
-			wantSuccess:   true,
-			wantCmd:       "georadius_ro",
-			wantCalls:     75,
-			wantUsecTotal: 1260,
-		},
-		{
-			fieldKey:    "borked_stats",
-			fieldValue:  "calls=75,usec=1260,usec_per_call=16.80",
-			wantSuccess: false,
-		},
-		{
-			fieldKey:    "cmdstat_georadius_ro",
-			fieldValue:  "borked_values",
-			wantSuccess: false,
-		},
-
-		{
-			fieldKey:    "cmdstat_georadius_ro",
-			fieldValue:  "usec_per_call=16.80",
-			wantSuccess: false,
-		},
-		{
-			fieldKey:    "cmdstat_georadius_ro",
-			fieldValue:  "calls=ABC,usec=1260,usec_per_call=16.80",
-			wantSuccess: false,
-		},
-		{
-			fieldKey:    "cmdstat_georadius_ro",
-			fieldValue:  "calls=75,usec=DEF,usec_per_call=16.80",
-			wantSuccess: false,
-		},
-		{
-			fieldKey:    "cmdstat_georadius_ro",
-			fieldValue:  "calls=75,usec=DEF,usec_per_call=16.80",
-			wantSuccess: false,
-		},
-	} {
-		t.Run(tst.fieldKey+tst.fieldValue, func(t *testing.T) {
+// infoCollector runs extractInfoMetrics on a fixed INFO string so it can be gathered by a registry
+type infoCollector struct {
+	e    *Exporter
+	info string
+}
 
-			cmd, calls, usecTotal, err := parseMetricsCommandStats(tst.fieldKey, tst.fieldValue)
+func (c infoCollector) Describe(ch chan<- *prometheus.Desc) {}
 
-			if tst.wantSuccess && err != nil {
-				t.Fatalf("err: %s", err)
-				return
-			}
+func (c infoCollector) Collect(ch chan<- prometheus.Metric) {
+	c.e.extractInfoMetrics(ch, c.info, 1)
+}
 
-			if !tst.wantSuccess && err == nil {
-				t.Fatalf("expected err!")
-				return
-			}
+func gatherInfoMetrics(t *testing.T, e *Exporter, info string) map[string]*dto.MetricFamily {
+	r := prometheus.NewRegistry()
+	r.MustRegister(infoCollector{e: e, info: info})
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatalf("Gather() err: %s", err)
+	}
+	res := map[string]*dto.MetricFamily{}
+	for _, mf := range mfs {
+		res[mf.GetName()] = mf
+	}
+	return res
+}
 
-			if !tst.wantSuccess {
-				return
-			}
+func loadTestInfo(t *testing.T) string {
+	b, err := os.ReadFile("testdata/info-all.txt")
+	if err != nil {
+		t.Fatalf("couldn't load INFO fixture, err: %s", err)
+	}
+	return string(b)
+}
 
-			if cmd != tst.wantCmd {
-				t.Fatalf("cmd not matching, got: %s, wanted: %s", cmd, tst.wantCmd)
-			}
+func TestExportAllInfoFields(t *testing.T) {
+	info := loadTestInfo(t)
 
-			if calls != tst.wantCalls {
-				t.Fatalf("cmd not matching, got: %f, wanted: %f", calls, tst.wantCalls)
-			}
-			if usecTotal != tst.wantUsecTotal {
-				t.Fatalf("cmd not matching, got: %f, wanted: %f", usecTotal, tst.wantUsecTotal)
-			}
-		})
+	e, _ := NewKvrocksExporter("", Options{Namespace: "test"})
+	mfs := gatherInfoMetrics(t, e, info)
+	if _, ok := mfs["test_stats_instantaneous_input_kbps"]; ok {
+		t.Errorf("generic INFO fields should only be exported when enabled")
+	}
+
+	e, _ = NewKvrocksExporter("", Options{Namespace: "test", ExportAllInfoFields: true})
+	mfs = gatherInfoMetrics(t, e, info)
+	for name, wantType := range map[string]dto.MetricType{
+		"test_stats_instantaneous_input_kbps": dto.MetricType_GAUGE,
+		"test_stats_expired_keys_total":       dto.MetricType_COUNTER,
+		"test_persistence_last_bgsave_time":   dto.MetricType_GAUGE,
+		"test_clients_maxclients":             dto.MetricType_GAUGE,
+		"test_server_uptime_in_days":          dto.MetricType_GAUGE,
+
+		// fields with a dedicated metric keep it
+		"test_connected_clients":           dto.MetricType_GAUGE,
+		"test_commands_processed_total":    dto.MetricType_COUNTER,
+		"test_estimate_keys":               dto.MetricType_GAUGE,
+		"test_connected_slave_lag_seconds": dto.MetricType_GAUGE,
+	} {
+		mf, ok := mfs[name]
+		if !ok {
+			t.Errorf("metric %s not found", name)
+			continue
+		}
+		if mf.GetType() != wantType {
+			t.Errorf("metric %s has type %s, wanted: %s", name, mf.GetType(), wantType)
+		}
 	}
-}
 
-func TestParseCommandStatsHist(t *testing.T) {
-
-	for _, tst := range []struct {
-		fieldKey   string
-		fieldValue string
-
-		wantSuccess bool
-		wantCmd     string
-		wantBuckets map[float64]uint64
-		wantSum     uint64
-		wantCount   uint64
-	}{
-		{
-			fieldKey:    "cmdstathist_get",
-			fieldValue:  "10=1191,20=1,50=0,70=0,100=0,150=0,inf=0,sum=10000,count=1192",
-			wantSuccess: true,
-			wantCmd:     "get",
-			wantBuckets: map[float64]uint64{
-				0.00001:     1191,
-				0.00002:     1192,
-				0.00005:     1192,
-				0.00007:     1192,
-				0.0001:      1192,
-				0.00015:     1192,
-				math.Inf(1): 1192,
-			},
-			wantSum:   10000,
-			wantCount: 1192,
-		},
-		{
-			fieldKey:    "cmdstathist_hget",
-			fieldValue:  "",
-			wantSuccess: true,
-			wantCmd:     "hget",
-			wantBuckets: map[float64]uint64{},
-		},
-		{
-			fieldKey:    "cmdstathis_hget",
-			fieldValue:  "fd",
-			wantSuccess: false,
-			wantCmd:     "hget",
-		},
-		{
-			fieldKey:    "cmdstathist_hget",
-			fieldValue:  "fd",
-			wantSuccess: false,
-			wantCmd:     "hget",
-		},
-		{
-			fieldKey:    "cmdstathist_hget",
-			fieldValue:  "fd=malformed",
-			wantSuccess: false,
-			wantCmd:     "hget",
-		},
-		{
-			fieldKey:    "cmdstathist_get",
-			fieldValue:  "10=1191,20=1,50=0,70=0,100=0,150=0,inf=0,sum=,count=1192",
-			wantSuccess: false,
-			wantCmd:     "get",
-			wantBuckets: map[float64]uint64{
-				0.00001:     1191,
-				0.00002:     1192,
-				0.00005:     1192,
-				0.00007:     1192,
-				0.0001:      1192,
-				0.00015:     1192,
-				math.Inf(1): 1192,
-			},
-			wantSum:   0,
-			wantCount: 1192,
-		},
-		{
-			fieldKey:    "cmdstathist_get",
-			fieldValue:  "10=1191,20=1,50=0,70=0,100=0,150=0,inf=0,sum=aa,count=1192",
-			wantSuccess: false,
-			wantCmd:     "get",
-			wantBuckets: map[float64]uint64{
-				0.00001:     1191,
-				0.00002:     1192,
-				0.00005:     1192,
-				0.00007:     1192,
-				0.0001:      1192,
-				0.00015:     1192,
-				math.Inf(1): 1192,
-			},
-			wantSum:   0,
-			wantCount: 1192,
-		},
-		{
-			fieldKey:    "cmdstathist_get",
-			fieldValue:  "10=1191,20=1,50=0,70=0,100=0,150=0,inf=0,sum=10000,count=",
-			wantSuccess: false,
-			wantCmd:     "get",
-			wantBuckets: map[float64]uint64{
-				0.00001:     1191,
-				0.00002:     1192,
-				0.00005:     1192,
-				0.00007:     1192,
-				0.0001:      1192,
-				0.00015:     1192,
-				math.Inf(1): 1192,
-			},
-			wantSum:   10000,
-			wantCount: 0,
-		},
-		{
-			fieldKey:    "cmdstathist_get",
-			fieldValue:  "10=1191,20=1,50=0,70=0,100=0,150=0,inf=0,sum=10000,count=dasd",
-			wantSuccess: false,
-			wantCmd:     "get",
-			wantBuckets: map[float64]uint64{
-				0.00001:     1191,
-				0.00002:     1192,
-				0.00005:     1192,
-				0.00007:     1192,
-				0.0001:      1192,
-				0.00015:     1192,
-				math.Inf(1): 1192,
-			},
-			wantSum:   10000,
-			wantCount: 0,
-		},
+	if lbls := mfs["test_stats_instantaneous_input_kbps"].GetMetric()[0].GetLabel(); len(lbls) != 1 || lbls[0].GetName() != "section" || lbls[0].GetValue() != "stats" {
+		t.Errorf("unexpected labels: %v", lbls)
+	}
+
+	for _, name := range []string{
+		// non-numeric
+		"test_server_version",
+		"test_stats_last_bgsave_status",
+		// handled by dedicated metrics
+		"test_server_connected_clients",
+		"test_rocksdb_estimate_keys",
+		"test_keyspace_db0",
+		"test_replication_slave0",
 	} {
-		t.Run(tst.fieldKey+tst.fieldValue, func(t *testing.T) {
-			cmd, count, sum, buckets, err := parseMetricsCommandStatsHist(tst.fieldKey, tst.fieldValue)
+		if _, ok := mfs[name]; ok {
+			t.Errorf("didn't expect metric %s", name)
+		}
+	}
+}
 
-			if tst.wantSuccess && err != nil {
-				t.Fatalf("err: %s", err)
-				return
-			}
+func TestExportAllInfoFieldsFilters(t *testing.T) {
+	info := loadTestInfo(t)
 
-			if !tst.wantSuccess && err == nil {
-				t.Fatalf("expected err!")
-				return
-			}
+	e, err := NewKvrocksExporter("", Options{Namespace: "test", ExportAllInfoFields: true, InfoFieldsInclude: "^(stats|cpu)_", InfoFieldsExclude: "kbps"})
+	if err != nil {
+		t.Fatalf("NewKvrocksExporter() err: %s", err)
+	}
+	mfs := gatherInfoMetrics(t, e, info)
 
-			if !tst.wantSuccess {
-				return
-			}
+	if _, ok := mfs["test_stats_expired_keys_total"]; !ok {
+		t.Errorf("expected test_stats_expired_keys_total")
+	}
+	for _, name := range []string{"test_stats_instantaneous_input_kbps", "test_persistence_last_bgsave_time"} {
+		if _, ok := mfs[name]; ok {
+			t.Errorf("didn't expect metric %s", name)
+		}
+	}
 
-			if cmd != tst.wantCmd {
-				t.Fatalf("cmd not matching, got: %s, wanted: %s", cmd, tst.wantCmd)
-			}
+	if _, err := NewKvrocksExporter("", Options{InfoFieldsExclude: "("}); err == nil {
+		t.Errorf("expected error for invalid regex")
+	}
+}
 
-			if !reflect.DeepEqual(buckets, tst.wantBuckets) {
-				t.Fatalf("cmd not matching, got: %v, wanted: %v", buckets, tst.wantBuckets)
-			}
+func TestIsCounterInfoField(t *testing.T) {
+	for field, want := range map[string]bool{
+		"total_net_input_bytes": true,
+		"keyspace_hits":         true,
+		"expired_keys":          true,
+		"flush_count":           true,
+		"connected_clients":     false,
+		"estimate_keys":         false,
+		"used_disk_size":        false,
+	} {
+		if got := isCounterInfoField(field); got != want {
+			t.Errorf("isCounterInfoField(%s) = %t, wanted: %t", field, got, want)
+		}
+	}
+}
 
-			if count != tst.wantCount {
-				t.Fatalf("count not matching, got: %d, wanted: %d", count, tst.wantCount)
-			}
+func TestExtractInfoMetrics(t *testing.T) {
+	e, _ := NewKvrocksExporter("", Options{Namespace: "test"})
+	mfs := gatherInfoMetrics(t, e, loadTestInfo(t))
+
+	for name, want := range map[string]float64{
+		"test_connected_clients":           42,
+		"test_commands_processed_total":    91827361,
+		"test_db_keys":                     1827364,
+		"test_db_avg_ttl_seconds":          3600,
+		"test_instance_info":               1,
+		"test_is_compacting":               1,
+		"test_block_cache_hit_total":       918273645,
+		"test_connected_slave_lag_seconds": 0,
+	} {
+		mf, ok := mfs[name]
+		if !ok {
+			t.Errorf("metric %s not found", name)
+			continue
+		}
+		m := mf.GetMetric()[0]
+		got := m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		if got != want {
+			t.Errorf("metric %s: got %f, wanted: %f", name, got, want)
+		}
+	}
 
-			if sum != tst.wantSum {
-				t.Fatalf("count not matching, got: %d, wanted: %d", sum, tst.wantSum)
-			}
-		})
+	for name, wantSeries := range map[string]int{
+		"test_commands_total":                   10,
+		"test_commands_duration_seconds_bucket": 2,
+		"test_connected_slave_offset_bytes":     2,
+		"test_estimate_keys":                    6,
+		"test_block_cache_usage":                6,
+		"test_write_stalls_total":               36,
+	} {
+		if got := len(mfs[name].GetMetric()); got != wantSeries {
+			t.Errorf("metric %s: got %d series, wanted: %d", name, got, wantSeries)
+		}
 	}
+}
 
+func BenchmarkExtractInfoMetrics(b *testing.B) {
+	buf, err := os.ReadFile("testdata/info-all-large.txt")
+	if err != nil {
+		b.Fatalf("couldn't read testdata: %s", err)
+	}
+	infoAll := string(buf)
+	e, _ := NewKvrocksExporter("", Options{Namespace: "test"})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ch := make(chan prometheus.Metric, 4096)
+		e.extractInfoMetrics(ch, infoAll, 16)
+		close(ch)
+		for range ch {
+		}
+	}
 }
@@ -0,0 +1,132 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// splitKeyPatterns returns the key patterns of a comma separated list like "queue:*,events"
+func splitKeyPatterns(s string) []string {
+	var res []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+func isGlobPattern(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// maxScanCalls is the number of SCAN calls scanKeys makes per scrape, at COUNT 1000 it looks at up to 100k keys
+const maxScanCalls = 100
+
+/*
+scanKeys returns the keys matching patterns, at most max of them.
+Patterns without glob characters are taken as key names, the others are looked up with SCAN. If keyType is set the keys
+of other types are skipped and don't count towards max.
+truncated is set if more keys matched or the SCAN calls ran out before the keyspace was walked through.
+*/
+func scanKeys(c redis.Conn, patterns []string, keyType string, max int) (keys []string, truncated bool) {
+	seen := map[string]bool{}
+	add := func(key string) bool {
+		if seen[key] {
+			return true
+		}
+		seen[key] = true
+		if keyType != "" {
+			if t, err := redis.String(doRedisCmd(c, "TYPE", key)); err != nil || t != keyType {
+				return true
+			}
+		}
+		if len(keys) >= max {
+			return false
+		}
+		keys = append(keys, key)
+		return true
+	}
+
+	scanCalls := 0
+	for _, pattern := range patterns {
+		if !isGlobPattern(pattern) {
+			if !add(pattern) {
+				return keys, true
+			}
+			continue
+		}
+
+		cursor := "0"
+		for {
+			if scanCalls >= maxScanCalls {
+				log.Warnf("Stopped scanning for keys matching %s after %d SCAN calls", pattern, scanCalls)
+				return keys, true
+			}
+			scanCalls++
+
+			values, err := redis.Values(doRedisCmd(c, "SCAN", cursor, "MATCH", pattern, "COUNT", 1000))
+			if err != nil || len(values) != 2 {
+				log.Errorf("Couldn't scan for keys matching %s, err: %v", pattern, err)
+				break
+			}
+			cursor, _ = redis.String(values[0], nil)
+			found, _ := redis.Strings(values[1], nil)
+			for _, key := range found {
+				if !add(key) {
+					return keys, true
+				}
+			}
+			if cursor == "0" || cursor == "" {
+				break
+			}
+		}
+	}
+	return keys, false
+}
+
+// keyWalker walks through the keyspace with SCAN, the cursor is kept between scrapes
+type keyWalker struct {
+	cursor string
+}
+
+/*
+walk scans the keyspace from the cursor for up to budget keys and calls fn for the keys found, done is set once the
+walk is complete. The budget is what SCAN is asked for rather than the keys it returned, SCAN can return empty pages
+for a sparse keyspace or one with many expired keys and would otherwise go through most of it in a single scrape.
+*/
+func (w *keyWalker) walk(c redis.Conn, budget int, fn func(key string)) (done bool, err error) {
+	if w.cursor == "" {
+		w.cursor = "0"
+	}
+	for scanned := 0; scanned < budget; {
+		count := budget - scanned
+		if count > 100 {
+			count = 100
+		}
+		values, err := redis.Values(doRedisCmd(c, "SCAN", w.cursor, "COUNT", count))
+		if err != nil {
+			return false, err
+		}
+		if len(values) != 2 {
+			return false, fmt.Errorf("invalid SCAN reply: %v", values)
+		}
+		cursor, _ := redis.String(values[0], nil)
+		keys, _ := redis.Strings(values[1], nil)
+
+		for _, key := range keys {
+			fn(key)
+		}
+		scanned += count
+
+		if cursor == "0" || cursor == "" {
+			w.cursor = "0"
+			return true, nil
+		}
+		w.cursor = cursor
+	}
+	return false, nil
+}
@@ -0,0 +1,41 @@
+package exporter
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestKeyWalkerBudget(t *testing.T) {
+	// a sparse keyspace, SCAN returns empty pages until the last one
+	b := &CaptureBundle{Version: captureBundleVersion}
+	for i := 0; i < 10; i++ {
+		next := strconv.Itoa(i + 1)
+		if i == 9 {
+			next = "0"
+		}
+		for _, count := range []string{"100", "50"} {
+			reply, _ := captureValue([]interface{}{[]byte(next), []interface{}{}})
+			b.Replies = append(b.Replies, CapturedReply{Command: []string{"SCAN", strconv.Itoa(i), "COUNT", count}, Reply: reply})
+		}
+	}
+	c := newReplayConn(b)
+
+	w := &keyWalker{}
+	done, err := w.walk(c, 250, func(string) {})
+	if err != nil {
+		t.Fatalf("walk() err: %s", err)
+	}
+	// 3 SCAN calls for COUNT 100, 100 and 50
+	if done || w.cursor != "3" {
+		t.Errorf("walk() got done: %t at cursor %s, want to stop at cursor 3", done, w.cursor)
+	}
+
+	for i := 0; i < 3 && !done; i++ {
+		if done, err = w.walk(c, 250, func(string) {}); err != nil {
+			t.Fatalf("walk() err: %s", err)
+		}
+	}
+	if !done || w.cursor != "0" {
+		t.Errorf("walk() got done: %t at cursor %s, want the walk to be complete", done, w.cursor)
+	}
+}
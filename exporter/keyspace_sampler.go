@@ -0,0 +1,185 @@
+package exporter
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultKeyspaceMaxPrefixes = 50
+
+	// prefix of the keys of the prefixes over the cap and of keys not matching the prefix regex
+	otherKeyspacePrefix = "other"
+)
+
+// upper bounds in seconds of the buckets of the TTL histogram
+var keyspaceTTLBuckets = []float64{60, 300, 3600, 6 * 3600, 86400, 7 * 86400, 30 * 86400}
+
+type keyspacePrefixStats struct {
+	keysByType map[string]uint64
+	keys       uint64
+	expiring   uint64
+	ttlSum     float64
+	ttlBuckets []uint64 // by keyspaceTTLBuckets, not cumulative
+}
+
+// keyspacePass holds the keys sampled in one walk through the keyspace by prefix
+type keyspacePass struct {
+	prefixes map[string]*keyspacePrefixStats
+	sampled  uint64
+}
+
+func newKeyspacePass() *keyspacePass {
+	return &keyspacePass{prefixes: map[string]*keyspacePrefixStats{}}
+}
+
+/*
+add counts a key of prefix, ttl is the remaining time to live in seconds or negative for keys that don't expire.
+One of the maxPrefixes is kept for "other", the keys of the prefixes beyond the others are counted there.
+*/
+func (p *keyspacePass) add(prefix, typ string, ttl float64, maxPrefixes int) {
+	p.sampled++
+
+	st := p.prefixes[prefix]
+	if st == nil {
+		prefixes := len(p.prefixes)
+		if _, ok := p.prefixes[otherKeyspacePrefix]; ok {
+			prefixes--
+		}
+		if prefixes >= maxPrefixes-1 {
+			prefix = otherKeyspacePrefix
+			st = p.prefixes[prefix]
+		}
+		if st == nil {
+			st = &keyspacePrefixStats{keysByType: map[string]uint64{}, ttlBuckets: make([]uint64, len(keyspaceTTLBuckets))}
+			p.prefixes[prefix] = st
+		}
+	}
+
+	st.keys++
+	st.keysByType[typ]++
+	if ttl >= 0 {
+		st.expiring++
+		st.ttlSum += ttl
+		if i := sort.SearchFloat64s(keyspaceTTLBuckets, ttl); i < len(keyspaceTTLBuckets) {
+			st.ttlBuckets[i]++
+		}
+	}
+}
+
+// keyspaceSampler walks the keyspace like the big key sampler and groups the keys by prefix, type and TTL
+type keyspaceSampler struct {
+	walker keyWalker
+	pass   *keyspacePass
+	last   *keyspacePass
+
+	prefixRegex *regexp.Regexp
+}
+
+func newKeyspaceSampler(prefixRegex *regexp.Regexp) *keyspaceSampler {
+	return &keyspaceSampler{pass: newKeyspacePass(), prefixRegex: prefixRegex}
+}
+
+/*
+keyPrefix returns the prefix of key: with a regex the capture groups joined by the delimiter, or the whole match
+for a regex without groups, and "other" for keys not matching it. Without regex it's the first depth parts of the key.
+*/
+func keyPrefix(key, delimiter string, depth int, re *regexp.Regexp) string {
+	if re != nil {
+		m := re.FindStringSubmatch(key)
+		if m == nil {
+			return otherKeyspacePrefix
+		}
+		if len(m) == 1 {
+			return m[0]
+		}
+		return strings.Join(m[1:], delimiter)
+	}
+
+	parts := strings.SplitN(key, delimiter, depth+1)
+	if len(parts) > depth {
+		parts = parts[:depth]
+	}
+	return strings.Join(parts, delimiter)
+}
+
+func (e *Exporter) keyspacePrefixOptions() (delimiter string, depth, maxPrefixes int) {
+	delimiter, depth, maxPrefixes = e.options.KeyspaceDelimiter, e.options.KeyspacePrefixDepth, e.options.KeyspaceMaxPrefixes
+	if delimiter == "" {
+		delimiter = ":"
+	}
+	if depth <= 0 {
+		depth = 1
+	}
+	if maxPrefixes <= 0 {
+		maxPrefixes = defaultKeyspaceMaxPrefixes
+	}
+	return delimiter, depth, maxPrefixes
+}
+
+func (e *Exporter) sampleKeyspace(c redis.Conn) error {
+	s := e.keyspace
+	delimiter, depth, maxPrefixes := e.keyspacePrefixOptions()
+
+	done, err := s.walker.walk(c, e.options.KeyspaceSampleBudget, func(key string) {
+		typ, err := redis.String(doRedisCmd(c, "TYPE", key))
+		if err != nil || typ == "none" {
+			return
+		}
+		pttl, err := redis.Int64(doRedisCmd(c, "PTTL", key))
+		if err != nil || pttl == -2 {
+			return
+		}
+		s.pass.add(keyPrefix(key, delimiter, depth, s.prefixRegex), typ, float64(pttl)/1e3, maxPrefixes)
+	})
+	if done {
+		s.last = s.pass
+		s.pass = newKeyspacePass()
+	}
+	return err
+}
+
+/*
+extractKeyspaceSampleMetrics estimates the keys per prefix and type from their share of the sampled keys and
+the number of keys reported by DBSIZE. The numbers are the ones of the last complete walk through the keyspace,
+or of the current one until the first walk is complete.
+*/
+func (e *Exporter) extractKeyspaceSampleMetrics(ch chan<- prometheus.Metric, c redis.Conn) {
+	if err := e.sampleKeyspace(c); err != nil {
+		log.Errorf("Couldn't sample the keyspace, err: %s", err)
+	}
+
+	p := e.keyspace.last
+	if p == nil {
+		p = e.keyspace.pass
+	}
+	e.registerConstMetricGauge(ch, "keyspace_sampled_keys", float64(p.sampled))
+	if p.sampled == 0 {
+		return
+	}
+
+	total := float64(p.sampled)
+	if dbSize, err := redis.Int64(doRedisCmd(c, "DBSIZE")); err == nil && dbSize > 0 {
+		total = float64(dbSize)
+	}
+
+	for prefix, st := range p.prefixes {
+		for typ, n := range st.keysByType {
+			e.registerConstMetricGauge(ch, "keyspace_prefix_keys_estimated", float64(n)/float64(p.sampled)*total, prefix, typ)
+		}
+		e.registerConstMetricGauge(ch, "keyspace_prefix_expiring_ratio", float64(st.expiring)/float64(st.keys), prefix)
+
+		buckets := make(map[float64]uint64, len(keyspaceTTLBuckets))
+		var cumulative uint64
+		for i, le := range keyspaceTTLBuckets {
+			cumulative += st.ttlBuckets[i]
+			buckets[le] = cumulative
+		}
+		e.registerHist(ch, "keyspace_prefix_ttl_seconds", st.expiring, st.ttlSum, buckets, prefix)
+	}
+}
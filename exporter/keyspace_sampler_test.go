@@ -0,0 +1,134 @@
+package exporter
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestKeyPrefix(t *testing.T) {
+	re := regexp.MustCompile(`^(\w+):\d+:(\w+)`)
+	for _, tst := range []struct {
+		key       string
+		delimiter string
+		depth     int
+		re        *regexp.Regexp
+		want      string
+	}{
+		{key: "user:1:profile", delimiter: ":", depth: 1, want: "user"},
+		{key: "user:1:profile", delimiter: ":", depth: 2, want: "user:1"},
+		{key: "counter", delimiter: ":", depth: 1, want: "counter"},
+		{key: "app/cache/1", delimiter: "/", depth: 2, want: "app/cache"},
+		{key: "user:1:profile", delimiter: ":", re: re, want: "user:profile"},
+		{key: "user:abc:profile", delimiter: ":", re: re, want: "other"},
+		{key: "session:42", delimiter: ":", re: regexp.MustCompile(`^session`), want: "session"},
+	} {
+		if got := keyPrefix(tst.key, tst.delimiter, tst.depth, tst.re); got != tst.want {
+			t.Errorf("keyPrefix(%s) got: %s, want: %s", tst.key, got, tst.want)
+		}
+	}
+}
+
+func TestKeyspacePassMaxPrefixes(t *testing.T) {
+	p := newKeyspacePass()
+	for _, prefix := range []string{"a", "b", "a", "c", "d", "b"} {
+		p.add(prefix, "string", -1, 3)
+	}
+	if len(p.prefixes) != 3 {
+		t.Fatalf("want 2 prefixes and other, got: %v", p.prefixes)
+	}
+	for prefix, want := range map[string]uint64{"a": 2, "b": 2, "other": 2} {
+		if got := p.prefixes[prefix].keys; got != want {
+			t.Errorf("want %d keys for %s, got: %d", want, prefix, got)
+		}
+	}
+}
+
+func TestKeyspacePrefixSeriesAtCap(t *testing.T) {
+	b := testCaptureBundle(t)
+	var keys []interface{}
+	for _, key := range []string{"a:1", "b:1", "c:1", "d:1", "e:1"} {
+		keys = append(keys, []byte(key))
+		b.Replies = append(b.Replies,
+			CapturedReply{Command: []string{"TYPE", key}, Reply: CapturedValue{Type: "status", Str: "string"}},
+			CapturedReply{Command: []string{"PTTL", key}, Reply: CapturedValue{Type: "int", Int: -1}},
+		)
+	}
+	scan, _ := captureValue([]interface{}{[]byte("0"), keys})
+	b.Replies = append(b.Replies, CapturedReply{Command: []string{"SCAN", "0", "COUNT", "100"}, Reply: scan})
+
+	registry := prometheus.NewRegistry()
+	if _, err := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", KeyspaceSampleBudget: 100, KeyspaceMaxPrefixes: 3, ReplayBundle: b, Registry: registry}); err != nil {
+		t.Fatalf("NewKvrocksExporter() err: %s", err)
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() err: %s", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "test_keyspace_prefix_expiring_ratio" {
+			continue
+		}
+		prefixes := map[string]bool{}
+		for _, m := range mf.GetMetric() {
+			prefixes[m.GetLabel()[0].GetValue()] = true
+		}
+		if len(prefixes) != 3 || !prefixes["a"] || !prefixes["b"] || !prefixes["other"] {
+			t.Errorf("want the prefixes a, b and other at the cap of 3, got: %v", prefixes)
+		}
+		return
+	}
+	t.Errorf("want test_keyspace_prefix_expiring_ratio to be exported")
+}
+
+func TestKeyspaceSampleMetrics(t *testing.T) {
+	b := testCaptureBundle(t)
+	for _, r := range []struct {
+		cmd []string
+		v   interface{}
+	}{
+		{cmd: []string{"SCAN", "0", "COUNT", "100"}, v: []interface{}{[]byte("0"), []interface{}{[]byte("user:1"), []byte("user:2"), []byte("session:a"), []byte("session:b")}}},
+		{cmd: []string{"TYPE", "user:1"}, v: "hash"},
+		{cmd: []string{"TYPE", "user:2"}, v: "hash"},
+		{cmd: []string{"TYPE", "session:a"}, v: "string"},
+		{cmd: []string{"TYPE", "session:b"}, v: "string"},
+		{cmd: []string{"PTTL", "user:1"}, v: int64(-1)},
+		{cmd: []string{"PTTL", "user:2"}, v: int64(-1)},
+		{cmd: []string{"PTTL", "session:a"}, v: int64(120000)},
+		{cmd: []string{"PTTL", "session:b"}, v: int64(-1)},
+		{cmd: []string{"DBSIZE"}, v: int64(400)},
+	} {
+		val, err := captureValue(r.v)
+		if err != nil {
+			t.Fatalf("captureValue() err: %s", err)
+		}
+		b.Replies = append(b.Replies, CapturedReply{Command: r.cmd, Reply: val})
+	}
+
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", KeyspaceSampleBudget: 1000, ReplayBundle: b, Registry: prometheus.NewRegistry()})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/metrics")
+	for _, want := range []string{
+		`test_keyspace_sampled_keys 4`,
+		`test_keyspace_prefix_keys_estimated{prefix="user",type="hash"} 200`,
+		`test_keyspace_prefix_keys_estimated{prefix="session",type="string"} 200`,
+		`test_keyspace_prefix_expiring_ratio{prefix="session"} 0.5`,
+		`test_keyspace_prefix_expiring_ratio{prefix="user"} 0`,
+		`test_keyspace_prefix_ttl_seconds_bucket{prefix="session",le="60"} 0`,
+		`test_keyspace_prefix_ttl_seconds_bucket{prefix="session",le="300"} 1`,
+		`test_keyspace_prefix_ttl_seconds_sum{prefix="session"} 120`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+
+	if _, err := NewKvrocksExporter("localhost:6666", Options{KeyspaceSampleBudget: 10, KeyspacePrefixRegex: "("}); err == nil {
+		t.Errorf("expected error for an invalid prefix regex")
+	}
+}
@@ -11,12 +11,71 @@ import (
 
 var metricNameRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
 
+// INFO fields with one of these prefixes or suffixes are monotonically increasing and exported as counters
+var (
+	counterFieldPrefixes = []string{"total_"}
+	counterFieldSuffixes = []string{"_total", "_count", "_hit", "_hits", "_miss", "_misses", "_received", "_processed", "_expired", "_evicted", "_errors"}
+)
+
 func sanitizeMetricName(n string) string {
-	return metricNameRE.ReplaceAllString(n, "_")
+	// most names are valid already, only fall back to the regex if they aren't
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return metricNameRE.ReplaceAllString(n, "_")
+		}
+	}
+	return n
 }
 
-func newMetricDescr(namespace string, metricName string, docString string, labels []string) *prometheus.Desc {
-	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", metricName), docString, labels, nil)
+func newMetricDescr(namespace string, metricName string, docString string, labels []string, constLabels prometheus.Labels) *prometheus.Desc {
+	// the labels of a metric win over const labels of the same name, e.g. the role label of
+	// instance_info over the role label of the nodes scraped through /scrape_cluster
+	for _, l := range labels {
+		if _, ok := constLabels[l]; ok {
+			constLabels = withoutLabels(constLabels, labels)
+			break
+		}
+	}
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", metricName), docString, labels, constLabels)
+}
+
+// mergeLabels returns a new label set holding the labels of a overridden by those of b.
+func mergeLabels(a, b prometheus.Labels) prometheus.Labels {
+	res := prometheus.Labels{}
+	for k, v := range a {
+		res[k] = v
+	}
+	for k, v := range b {
+		res[k] = v
+	}
+	return res
+}
+
+// withoutLabels returns a copy of lbls without the given label names
+func withoutLabels(lbls prometheus.Labels, names []string) prometheus.Labels {
+	res := prometheus.Labels{}
+	for k, v := range lbls {
+		res[k] = v
+	}
+	for _, n := range names {
+		delete(res, n)
+	}
+	return res
+}
+
+func isCounterInfoField(fieldKey string) bool {
+	for _, p := range counterFieldPrefixes {
+		if strings.HasPrefix(fieldKey, p) {
+			return true
+		}
+	}
+	for _, s := range counterFieldSuffixes {
+		if strings.HasSuffix(fieldKey, s) {
+			return true
+		}
+	}
+	return fieldKey == "expired_keys" || fieldKey == "evicted_keys"
 }
 
 func (e *Exporter) includeMetric(s string) bool {
@@ -72,7 +131,24 @@ func (e *Exporter) parseAndRegisterConstMetric(ch chan<- prometheus.Metric, fiel
 		val = val / 1e6
 	}
 
-	e.registerConstMetric(ch, metricName, val, t)
+	if e.legacyNaming() {
+		e.registerConstMetric(ch, metricName, val, t)
+	}
+
+	if e.v2Naming() {
+		def, ok := v2InfoMetrics[orgMetricName]
+		if !ok {
+			// no v2 definition, e.g. cluster_* fields, the legacy name is the only one
+			if !e.legacyNaming() {
+				e.registerConstMetric(ch, metricName, val, t)
+			}
+			return
+		}
+		if e.legacyNaming() && def.name == metricName {
+			return
+		}
+		e.registerConstMetric(ch, def.name, val, def.valType)
+	}
 }
 
 func (e *Exporter) registerConstMetricGauge(ch chan<- prometheus.Metric, metric string, val float64, labels ...string) {
@@ -82,7 +158,7 @@ func (e *Exporter) registerConstMetricGauge(ch chan<- prometheus.Metric, metric
 func (e *Exporter) registerConstMetric(ch chan<- prometheus.Metric, metric string, val float64, valType prometheus.ValueType, labelValues ...string) {
 	descr := e.metricDescriptions[metric]
 	if descr == nil {
-		descr = newMetricDescr(e.options.Namespace, metric, metric+" metric", labelValues)
+		descr = newMetricDescr(e.options.Namespace, metric, metric+" metric", labelValues, e.options.ConstLabels)
 	}
 
 	if m, err := prometheus.NewConstMetric(descr, valType, val, labelValues...); err == nil {
@@ -93,7 +169,7 @@ func (e *Exporter) registerConstMetric(ch chan<- prometheus.Metric, metric strin
 func (e *Exporter) registerHist(ch chan<- prometheus.Metric, metric string, count uint64, sum float64, buckets map[float64]uint64, labelValues ...string) {
 	descr := e.metricDescriptions[metric]
 	if descr == nil {
-		descr = newMetricDescr(e.options.Namespace, metric, metric+" metric", labelValues)
+		descr = newMetricDescr(e.options.Namespace, metric, metric+" metric", labelValues, e.options.ConstLabels)
 	}
 
 	if m, err := prometheus.NewConstHistogram(descr, count, sum, buckets, labelValues...); err == nil {
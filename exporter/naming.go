@@ -0,0 +1,126 @@
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Values for Options.MetricNaming
+const (
+	MetricNamingLegacy = "legacy"
+	MetricNamingV2     = "v2"
+	MetricNamingBoth   = "both"
+)
+
+type infoMetricDef struct {
+	name    string
+	help    string
+	valType prometheus.ValueType
+}
+
+func gaugeDef(name, help string) infoMetricDef {
+	return infoMetricDef{name: name, help: help, valType: prometheus.GaugeValue}
+}
+
+func counterDef(name, help string) infoMetricDef {
+	return infoMetricDef{name: name, help: help, valType: prometheus.CounterValue}
+}
+
+// v2InfoMetrics maps INFO fields to metric names, types and help texts that follow the Prometheus
+// naming conventions: monotonic values are counters ending in _total and sizes end in _bytes.
+var v2InfoMetrics = map[string]infoMetricDef{
+	// # Server
+	"uptime_in_seconds": gaugeDef("uptime_in_seconds", "Number of seconds since the Kvrocks server started"),
+	"process_id":        gaugeDef("process_id", "Process id of the Kvrocks server"),
+
+	// # Clients
+	"connected_clients": gaugeDef("connected_clients", "Number of client connections"),
+	"blocked_clients":   gaugeDef("blocked_clients", "Number of clients pending on a blocking call"),
+	"monitor_clients":   gaugeDef("monitor_clients", "Number of clients running MONITOR"),
+
+	// # Memory
+	"used_memory":         gaugeDef("memory_used_bytes", "Memory used by the Kvrocks server in bytes"),
+	"used_memory_rss":     gaugeDef("memory_used_rss_bytes", "Resident set size of the Kvrocks server in bytes"),
+	"used_memory_lua":     gaugeDef("memory_used_lua_bytes", "Memory used by the Lua engine in bytes"),
+	"total_system_memory": gaugeDef("total_system_memory_bytes", "Total memory of the host in bytes"),
+
+	// # Persistence
+	"loading": gaugeDef("loading", "Whether the Kvrocks server is loading data"),
+
+	// # Stats
+	"pubsub_channels":            gaugeDef("pubsub_channels", "Number of pubsub channels with subscribers"),
+	"pubsub_patterns":            gaugeDef("pubsub_patterns", "Number of pubsub patterns with subscribers"),
+	"keyspace_hits":              counterDef("keyspace_hits_total", "Number of successful key lookups"),
+	"keyspace_misses":            counterDef("keyspace_misses_total", "Number of failed key lookups"),
+	"total_connections_received": counterDef("connections_received_total", "Number of connections accepted by the server"),
+	"total_commands_processed":   counterDef("commands_processed_total", "Number of commands processed by the server"),
+	"rejected_connections":       counterDef("rejected_connections_total", "Number of connections rejected because of maxclients"),
+	"total_net_input_bytes":      counterDef("net_input_bytes_total", "Number of bytes read from the network"),
+	"total_net_output_bytes":     counterDef("net_output_bytes_total", "Number of bytes written to the network"),
+	"instantaneous_ops_per_sec":  gaugeDef("instantaneous_ops_per_sec", "Number of commands processed per second"),
+
+	// # CPU
+	"used_cpu_sys":  counterDef("cpu_sys_seconds_total", "System CPU consumed by the Kvrocks server in seconds"),
+	"used_cpu_user": counterDef("cpu_user_seconds_total", "User CPU consumed by the Kvrocks server in seconds"),
+
+	// # Replication
+	"connected_slaves":   gaugeDef("connected_slaves", "Number of connected replicas"),
+	"master_repl_offset": gaugeDef("master_repl_offset_bytes", "Replication offset of the master in bytes"),
+	"sync_full":          counterDef("replica_resyncs_full_total", "Number of full resyncs with replicas"),
+	"sync_partial_ok":    counterDef("replica_partial_resync_accepted_total", "Number of accepted partial resync requests"),
+	"sync_partial_err":   counterDef("replica_partial_resync_denied_total", "Number of denied partial resync requests"),
+
+	// # Keyspace
+	"sequence":       gaugeDef("sequence", "Latest sequence number of the RocksDB write-ahead log"),
+	"used_db_size":   gaugeDef("used_db_size_bytes", "Size of the data in bytes"),
+	"max_db_size":    gaugeDef("max_db_size_bytes", "Configured maximum size of the data in bytes, 0 if unlimited"),
+	"disk_capacity":  gaugeDef("disk_capacity_bytes", "Capacity of the disk holding the data directory in bytes"),
+	"used_disk_size": gaugeDef("used_disk_size_bytes", "Used size of the disk holding the data directory in bytes"),
+
+	// # RocksDB
+	"all_mem_tables":          gaugeDef("all_mem_tables_bytes", "Size of the active and unflushed immutable memtables in bytes"),
+	"cur_mem_tables":          gaugeDef("cur_mem_tables_bytes", "Size of the active memtables in bytes"),
+	"snapshots":               gaugeDef("snapshots", "Number of unreleased RocksDB snapshots"),
+	"num_immutable_tables":    gaugeDef("num_immutable_tables", "Number of immutable memtables not yet flushed"),
+	"num_running_flushes":     gaugeDef("num_running_flushes", "Number of currently running flushes"),
+	"memtable_flush_pending":  gaugeDef("memtable_flush_pending", "Number of pending memtable flushes"),
+	"compaction_pending":      gaugeDef("compaction_pending", "Number of column families with a pending compaction"),
+	"num_running_compactions": gaugeDef("num_running_compactions", "Number of currently running compactions"),
+	"num_live_versions":       gaugeDef("num_live_versions", "Number of live RocksDB versions"),
+	"num_superversion":        gaugeDef("num_superversion", "Number of RocksDB super versions"),
+	"num_background_errors":   counterDef("background_errors_total", "Number of RocksDB background errors"),
+	"flush_count":             counterDef("flushes_total", "Number of memtable flushes"),
+	"compaction_count":        counterDef("compactions_total", "Number of compactions"),
+	"is_bgsaving":             gaugeDef("is_bgsaving", "Whether a backup is in progress"),
+	"is_compacting":           gaugeDef("is_compacting", "Whether a compaction is in progress"),
+	"put_per_sec":             gaugeDef("put_per_sec", "Number of RocksDB puts per second"),
+	"get_per_sec":             gaugeDef("get_per_sec", "Number of RocksDB gets per second"),
+	"seek_per_sec":            gaugeDef("seek_per_sec", "Number of RocksDB seeks per second"),
+	"next_per_sec":            gaugeDef("next_per_sec", "Number of RocksDB iterator nexts per second"),
+	"prev_per_sec":            gaugeDef("prev_per_sec", "Number of RocksDB iterator prevs per second"),
+	"block_cache_hit":         counterDef("block_cache_hit_total", "Number of block cache hits"),
+	"block_cache_miss":        counterDef("block_cache_miss_total", "Number of block cache misses"),
+	"block_cache_data_hit":    counterDef("block_cache_data_hit_total", "Number of block cache hits for data blocks"),
+	"block_cache_data_miss":   counterDef("block_cache_data_miss_total", "Number of block cache misses for data blocks"),
+	"block_cache_index_hit":   counterDef("block_cache_index_hit_total", "Number of block cache hits for index blocks"),
+	"block_cache_index_miss":  counterDef("block_cache_index_miss_total", "Number of block cache misses for index blocks"),
+	"block_cache_filter_hit":  counterDef("block_cache_filter_hit_total", "Number of block cache hits for filter blocks"),
+	"block_cache_filter_miss": counterDef("block_cache_filter_miss_total", "Number of block cache misses for filter blocks"),
+}
+
+func validateMetricNaming(naming string) error {
+	switch naming {
+	case "", MetricNamingLegacy, MetricNamingV2, MetricNamingBoth:
+		return nil
+	}
+	return fmt.Errorf("invalid metric naming %q, valid options are %s, %s and %s", naming, MetricNamingLegacy, MetricNamingV2, MetricNamingBoth)
+}
+
+func (e *Exporter) legacyNaming() bool {
+	return e.options.MetricNaming != MetricNamingV2
+}
+
+func (e *Exporter) v2Naming() bool {
+	return e.options.MetricNaming == MetricNamingV2 || e.options.MetricNaming == MetricNamingBoth
+}
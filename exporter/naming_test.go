@@ -0,0 +1,100 @@
+package exporter
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMetricNaming(t *testing.T) {
+	info := loadTestInfo(t)
+
+	for _, tst := range []struct {
+		naming  string
+		want    map[string]dto.MetricType
+		notWant []string
+	}{
+		{
+			naming: "",
+			want: map[string]dto.MetricType{
+				"test_keyspace_hits":        dto.MetricType_GAUGE,
+				"test_used_db_size":         dto.MetricType_GAUGE,
+				"test_replica_resyncs_full": dto.MetricType_GAUGE,
+			},
+			notWant: []string{"test_keyspace_hits_total", "test_used_db_size_bytes"},
+		},
+		{
+			naming: MetricNamingV2,
+			want: map[string]dto.MetricType{
+				"test_keyspace_hits_total":        dto.MetricType_COUNTER,
+				"test_keyspace_misses_total":      dto.MetricType_COUNTER,
+				"test_flushes_total":              dto.MetricType_COUNTER,
+				"test_compactions_total":          dto.MetricType_COUNTER,
+				"test_replica_resyncs_full_total": dto.MetricType_COUNTER,
+				"test_used_db_size_bytes":         dto.MetricType_GAUGE,
+				"test_max_db_size_bytes":          dto.MetricType_GAUGE,
+				"test_used_disk_size_bytes":       dto.MetricType_GAUGE,
+				"test_disk_capacity_bytes":        dto.MetricType_GAUGE,
+				"test_connected_clients":          dto.MetricType_GAUGE,
+			},
+			notWant: []string{"test_keyspace_hits", "test_used_db_size", "test_flush_count"},
+		},
+		{
+			naming: MetricNamingBoth,
+			want: map[string]dto.MetricType{
+				"test_keyspace_hits":       dto.MetricType_GAUGE,
+				"test_keyspace_hits_total": dto.MetricType_COUNTER,
+				"test_used_db_size":        dto.MetricType_GAUGE,
+				"test_used_db_size_bytes":  dto.MetricType_GAUGE,
+				"test_connected_clients":   dto.MetricType_GAUGE,
+			},
+		},
+	} {
+		t.Run(tst.naming, func(t *testing.T) {
+			// registering fails if the exporter describes a metric twice
+			e, err := NewKvrocksExporter("", Options{Namespace: "test", MetricNaming: tst.naming, Registry: prometheus.NewRegistry()})
+			if err != nil {
+				t.Fatalf("NewKvrocksExporter() err: %s", err)
+			}
+
+			mfs := gatherInfoMetrics(t, e, info)
+			for name, wantType := range tst.want {
+				mf, ok := mfs[name]
+				if !ok {
+					t.Errorf("metric %s not found", name)
+					continue
+				}
+				if mf.GetType() != wantType {
+					t.Errorf("metric %s has type %s, wanted: %s", name, mf.GetType(), wantType)
+				}
+			}
+			for _, name := range tst.notWant {
+				if _, ok := mfs[name]; ok {
+					t.Errorf("didn't expect metric %s", name)
+				}
+			}
+
+			if tst.naming != "" {
+				if help := mfs["test_keyspace_hits_total"].GetHelp(); help != v2InfoMetrics["keyspace_hits"].help {
+					t.Errorf("unexpected help text: %s", help)
+				}
+			}
+		})
+	}
+
+	if _, err := NewKvrocksExporter("", Options{MetricNaming: "v3"}); err == nil {
+		t.Errorf("expected error for invalid metric naming")
+	}
+}
+
+func TestV2InfoMetricsComplete(t *testing.T) {
+	e, _ := NewKvrocksExporter("", Options{Namespace: "test"})
+	for _, m := range []map[string]string{e.metricMapGauges, e.metricMapCounters} {
+		for field := range m {
+			if _, ok := v2InfoMetrics[field]; !ok {
+				t.Errorf("no v2 metric for INFO field %s", field)
+			}
+		}
+	}
+}
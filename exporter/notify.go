@@ -0,0 +1,146 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// types of the events
+const (
+	EventRestarted        = "restarted"
+	EventRoleChanged      = "role_changed"
+	EventMasterChanged    = "master_changed"
+	EventMasterLinkDown   = "master_link_down"
+	EventMasterLinkUp     = "master_link_up"
+	EventLoadingStarted   = "loading_started"
+	EventLoadingFinished  = "loading_finished"
+	EventBackgroundErrors = "background_errors_increased"
+)
+
+const defaultWebhookQueueSize = 100
+
+// Event is a transition of an instance seen between two consecutive scrapes
+type Event struct {
+	Type     string    `json:"type"`
+	Instance string    `json:"instance"`
+	Time     time.Time `json:"time"`
+	// From and To are the values before and after the transition, e.g. the roles of role_changed
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// Labels are the const labels of the exporter of the instance, e.g. its target label
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Notifier is told about the events of the instances, Notify must not block the scrape
+type Notifier interface {
+	Notify(ev Event)
+}
+
+// LogNotifier logs the events as structured log entries
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ev Event) {
+	fields := log.Fields{"event": ev.Type, "instance": ev.Instance}
+	if ev.From != "" || ev.To != "" {
+		fields["from"], fields["to"] = ev.From, ev.To
+	}
+	for k, v := range ev.Labels {
+		fields[k] = v
+	}
+	log.WithFields(fields).Info("Kvrocks event")
+}
+
+// WebhookOptions configures posting the events to a webhook
+type WebhookOptions struct {
+	URL string
+	// Retries of a failed post, with a backoff doubling from Backoff
+	Retries int
+	Backoff time.Duration
+	Timeout time.Duration
+	// QueueSize is the number of events waiting to be posted, events beyond it are dropped
+	QueueSize int
+}
+
+/*
+WebhookNotifier posts every event as JSON to a URL. The events are posted one after the other from a queue,
+so a slow or failing webhook doesn't slow down the scrapes. Posts failing with a network error, a 5xx or a 429
+are retried, other responses are final.
+*/
+type WebhookNotifier struct {
+	opts   WebhookOptions
+	client *http.Client
+	events chan Event
+}
+
+// NewWebhookNotifier returns a WebhookNotifier posting the events in the background
+func NewWebhookNotifier(opts WebhookOptions) *WebhookNotifier {
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultWebhookQueueSize
+	}
+	n := &WebhookNotifier{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		events: make(chan Event, opts.QueueSize),
+	}
+	go n.run()
+	return n
+}
+
+func (n *WebhookNotifier) Notify(ev Event) {
+	select {
+	case n.events <- ev:
+	default:
+		log.Errorf("Webhook %s is behind, dropping %s event of %s", n.opts.URL, ev.Type, ev.Instance)
+	}
+}
+
+func (n *WebhookNotifier) run() {
+	for ev := range n.events {
+		if err := n.send(ev); err != nil {
+			log.Errorf("Couldn't post %s event of %s to %s, err: %s", ev.Type, ev.Instance, n.opts.URL, err)
+		}
+	}
+}
+
+// send posts ev, retrying with backoff
+func (n *WebhookNotifier) send(ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	backoff := n.opts.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(body)
+		if err == nil || !retry || attempt >= n.opts.Retries {
+			return err
+		}
+		log.Debugf("Posting %s event to %s failed, retrying in %s, err: %s", ev.Type, n.opts.URL, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (n *WebhookNotifier) post(body []byte) (retry bool, err error) {
+	resp, err := n.client.Post(n.opts.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, fmt.Errorf("unexpected status %s", resp.Status)
+}
@@ -0,0 +1,153 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type recordingNotifier struct {
+	sync.Mutex
+	events []Event
+}
+
+func (n *recordingNotifier) Notify(ev Event) {
+	n.Lock()
+	defer n.Unlock()
+	n.events = append(n.events, ev)
+}
+
+func (n *recordingNotifier) types() []string {
+	n.Lock()
+	defer n.Unlock()
+	var res []string
+	for _, ev := range n.events {
+		res = append(res, ev.Type)
+	}
+	n.events = nil
+	return res
+}
+
+func TestInstanceEvents(t *testing.T) {
+	base := loadTestInfo(t)
+	replica := func(s, linkStatus string) string {
+		return strings.Replace(s, "role:master", "role:slave\r\nmaster_host:10.0.0.1\r\nmaster_port:6666\r\nmaster_link_status:"+linkStatus, 1)
+	}
+	loading := strings.Replace(base, "loading:0", "loading:1", 1)
+	bgErrors := strings.Replace(base, "num_background_errors:0", "num_background_errors:2", 1)
+
+	n := &recordingNotifier{}
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", Notifiers: []Notifier{n}, ConstLabels: prometheus.Labels{"dc": "eu"}})
+	for _, step := range []struct {
+		info string
+		want []string
+	}{
+		{info: base},
+		{info: base},
+		{info: loading, want: []string{EventLoadingStarted}},
+		{info: base, want: []string{EventLoadingFinished}},
+		{info: bgErrors, want: []string{EventBackgroundErrors}},
+		{info: bgErrors},
+		{info: replica(base, "up"), want: []string{EventRoleChanged}},
+		{info: replica(base, "down"), want: []string{EventMasterLinkDown}},
+		{info: replica(base, "up"), want: []string{EventMasterLinkUp}},
+		{info: strings.Replace(base, "process_id:2041", "process_id:3301", 1), want: []string{EventRestarted, EventRoleChanged}},
+	} {
+		n.Lock()
+		n.events = nil
+		n.Unlock()
+		gatherInfoMetrics(t, e, step.info)
+
+		n.Lock()
+		for _, ev := range n.events {
+			if ev.Instance != "localhost:6666" || ev.Labels["dc"] != "eu" || ev.Time.IsZero() {
+				t.Errorf("unexpected event: %+v", ev)
+			}
+		}
+		n.Unlock()
+		if got := n.types(); strings.Join(got, ",") != strings.Join(step.want, ",") {
+			t.Errorf("events got: %v, want: %v", got, step.want)
+		}
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	received := make(chan Event, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		n := attempts
+		mu.Unlock()
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s with content type %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("couldn't decode event: %s", err)
+		}
+		received <- ev
+	}))
+	defer ts.Close()
+
+	n := NewWebhookNotifier(WebhookOptions{URL: ts.URL, Retries: 3, Backoff: time.Millisecond})
+	n.Notify(Event{Type: EventRoleChanged, Instance: "node-1:6666", Time: time.Now(), From: "slave", To: "master"})
+
+	select {
+	case ev := <-received:
+		if ev.Type != EventRoleChanged || ev.From != "slave" || ev.To != "master" || ev.Instance != "node-1:6666" {
+			t.Errorf("received unexpected event: %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the webhook didn't receive the event")
+	}
+	mu.Lock()
+	if attempts != 3 {
+		t.Errorf("got %d attempts, want 3", attempts)
+	}
+	mu.Unlock()
+}
+
+func TestWebhookNotifierRetries(t *testing.T) {
+	for _, tst := range []struct {
+		status       int
+		wantAttempts int
+	}{
+		{status: http.StatusInternalServerError, wantAttempts: 3},
+		{status: http.StatusTooManyRequests, wantAttempts: 3},
+		{status: http.StatusBadRequest, wantAttempts: 1},
+		{status: http.StatusNoContent, wantAttempts: 1},
+	} {
+		attempts := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(tst.status)
+		}))
+
+		n := &WebhookNotifier{opts: WebhookOptions{URL: ts.URL, Retries: 2, Backoff: time.Millisecond}, client: ts.Client()}
+		err := n.send(Event{Type: EventRestarted})
+		if (err != nil) != (tst.status >= 300) {
+			t.Errorf("send() with status %d err: %v", tst.status, err)
+		}
+		if attempts != tst.wantAttempts {
+			t.Errorf("send() with status %d got %d attempts, want %d", tst.status, attempts, tst.wantAttempts)
+		}
+		ts.Close()
+	}
+
+	n := &WebhookNotifier{opts: WebhookOptions{URL: "http://localhost:1", Retries: 1, Backoff: time.Millisecond}, client: http.DefaultClient}
+	if err := n.send(Event{Type: EventRestarted}); err == nil {
+		t.Errorf("expected error for an unreachable webhook")
+	}
+}
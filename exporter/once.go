@@ -0,0 +1,107 @@
+package exporter
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// WriteMetrics runs a single scrape of the registry of the exporter and writes the metrics in the
+// Prometheus text format or, with openMetrics set, in the OpenMetrics format.
+// up is false unless the scrape of every target of the exporter succeeded. Like the HTTP handler it
+// writes the metrics that could be gathered if some couldn't, err is set in that case too.
+func (e *Exporter) WriteMetrics(w io.Writer, openMetrics bool) (up bool, err error) {
+	up, gatherErr, err := e.writeMetrics(w, openMetrics)
+	if err != nil {
+		return false, err
+	}
+	return up, gatherErr
+}
+
+// WriteMetricsFile is like WriteMetrics but replaces the file at path atomically,
+// so a reader like the textfile collector of the node_exporter never sees a partial file.
+func (e *Exporter) WriteMetricsFile(path string, openMetrics bool) (up bool, err error) {
+	var gatherErr error
+	err = writeFileAtomic(path, func(w io.Writer) (err error) {
+		up, gatherErr, err = e.writeMetrics(w, openMetrics)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return up, gatherErr
+}
+
+// writeMetrics is WriteMetrics with the error of gathering the metrics apart from the one of writing them
+func (e *Exporter) writeMetrics(w io.Writer, openMetrics bool) (up bool, gatherErr, err error) {
+	if e.options.Registry == nil {
+		return false, nil, errors.New("the exporter has no registry")
+	}
+
+	mfs, gatherErr := e.options.Registry.Gather()
+
+	format := expfmt.NewFormat(expfmt.TypeTextPlain)
+	if openMetrics {
+		format = expfmt.NewFormat(expfmt.TypeOpenMetrics)
+	}
+	enc := expfmt.NewEncoder(w, format)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			return false, gatherErr, err
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return false, gatherErr, err
+		}
+	}
+
+	return isUp(mfs, prometheus.BuildFQName(e.options.Namespace, "", "up")), gatherErr, nil
+}
+
+func isUp(mfs []*dto.MetricFamily, name string) bool {
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if m.GetGauge().GetValue() != 1 {
+				return false
+			}
+		}
+		return len(mf.GetMetric()) > 0
+	}
+	return false
+}
+
+// writeFileAtomic writes to a temporary file next to path and renames it to path once it's complete
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	// the temporary file starts with a dot so it isn't picked up by globs like *.prom
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,108 @@
+package exporter
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", ReplayBundle: testCaptureBundle(t), Registry: prometheus.NewRegistry()})
+
+	var buf bytes.Buffer
+	up, err := e.WriteMetrics(&buf, false)
+	if err != nil {
+		t.Fatalf("WriteMetrics() err: %s", err)
+	}
+	if !up {
+		t.Errorf("want up")
+	}
+	if !strings.Contains(buf.String(), "test_up 1\n") {
+		t.Errorf("want metrics to include test_up 1, have:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if _, err := e.WriteMetrics(&buf, true); err != nil {
+		t.Fatalf("WriteMetrics() err: %s", err)
+	}
+	if !strings.HasSuffix(buf.String(), "# EOF\n") {
+		t.Errorf("want OpenMetrics output to end with # EOF, have:\n%s", buf.String())
+	}
+
+	if _, err := (&Exporter{}).WriteMetrics(&buf, false); err == nil {
+		t.Errorf("expected error without a registry")
+	}
+}
+
+func TestWriteMetricsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kvrocks.prom")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatalf("couldn't write file: %s", err)
+	}
+
+	e, _ := NewKvrocksExporter("localhost:1", Options{Namespace: "test", Registry: prometheus.NewRegistry()})
+	up, err := e.WriteMetricsFile(path, false)
+	if err != nil {
+		t.Fatalf("WriteMetricsFile() err: %s", err)
+	}
+	if up {
+		t.Errorf("want down for an unreachable instance")
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("couldn't read file: %s", err)
+	}
+	if !strings.Contains(string(b), "test_up 0\n") {
+		t.Errorf("want metrics to include test_up 0, have:\n%s", b)
+	}
+
+	// the temporary file is gone
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("want only the metrics file to be left, have: %v", entries)
+	}
+
+	if _, err := e.WriteMetricsFile(filepath.Join(dir, "missing", "kvrocks.prom"), false); err == nil {
+		t.Errorf("expected error for a missing directory")
+	}
+}
+
+// invalidCollector sends a metric that fails to be gathered
+type invalidCollector struct{}
+
+func (invalidCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (invalidCollector) Collect(ch chan<- prometheus.Metric) {
+	desc := prometheus.NewDesc("broken", "", nil, nil)
+	ch <- prometheus.NewInvalidMetric(desc, errors.New("broken"))
+}
+
+func TestWriteMetricsPartial(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(invalidCollector{})
+	e, _ := NewKvrocksExporter("localhost:6666", Options{ReplayBundle: testCaptureBundle(t), Registry: registry})
+
+	path := filepath.Join(t.TempDir(), "kvrocks.prom")
+	up, err := e.WriteMetricsFile(path, false)
+	if err == nil {
+		t.Errorf("expected error for the metric that couldn't be gathered")
+	}
+	// up is found without namespace too
+	if !up {
+		t.Errorf("want up")
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("couldn't read file: %s", err)
+	}
+	if !strings.Contains(string(b), "\nup 1\n") {
+		t.Errorf("want the metrics that were gathered to be written, have:\n%s", b)
+	}
+}
@@ -0,0 +1,305 @@
+package exporter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+)
+
+// PushOptions configures pushing the metrics of an exporter to a Pushgateway
+type PushOptions struct {
+	URL      string
+	Job      string
+	Interval time.Duration
+	Username string
+	Password string
+
+	CaCertFile          string
+	ClientCertFile      string
+	ClientKeyFile       string
+	SkipTLSVerification bool
+
+	// GroupByRole adds the role reported by INFO to the grouping labels. A failover leaves the group
+	// of the old role behind on the Pushgateway, so it's off by default.
+	GroupByRole bool
+
+	// Grouping labels on top of the instance, role and cluster labels derived from the target,
+	// they take precedence over the derived ones
+	Grouping map[string]string
+}
+
+// Pusher pushes the metrics of an exporter to a Pushgateway
+type Pusher struct {
+	e      *Exporter
+	opts   PushOptions
+	client *http.Client
+
+	pushes       prometheus.Counter
+	pushFailures prometheus.Counter
+}
+
+// NewPusher returns a Pusher for the metrics of the registry of e and registers
+// the push counters with that registry.
+func NewPusher(e *Exporter, opts PushOptions) (*Pusher, error) {
+	if e.options.Registry == nil {
+		return nil, errors.New("the exporter has no registry")
+	}
+	if opts.URL == "" {
+		return nil, errors.New("no Pushgateway URL")
+	}
+	if opts.Job == "" {
+		opts.Job = "kvrocks_exporter"
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 15 * time.Second
+	}
+
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	timeout := e.options.ConnectionTimeouts
+	if timeout == 0 {
+		timeout = 15 * time.Second
+	}
+
+	p := &Pusher{
+		e:    e,
+		opts: opts,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		},
+		pushes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   e.options.Namespace,
+			Name:        "exporter_pushes_total",
+			Help:        "Number of pushes to the Pushgateway.",
+			ConstLabels: e.options.ConstLabels,
+		}),
+		pushFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   e.options.Namespace,
+			Name:        "exporter_push_failures_total",
+			Help:        "Number of failed pushes to the Pushgateway.",
+			ConstLabels: e.options.ConstLabels,
+		}),
+	}
+	for _, c := range []prometheus.Collector{p.pushes, p.pushFailures} {
+		if err := e.options.Registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (o PushOptions) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: o.SkipTLSVerification,
+	}
+
+	if o.ClientCertFile != "" && o.ClientKeyFile != "" {
+		cert, err := LoadKeyPair(o.ClientCertFile, o.ClientKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+
+	if o.CaCertFile != "" {
+		caCert, err := os.ReadFile(o.CaCertFile)
+		if err != nil {
+			return nil, err
+		}
+		certificates := x509.NewCertPool()
+		certificates.AppendCertsFromPEM(caCert)
+		tlsConfig.RootCAs = certificates
+	}
+
+	return tlsConfig, nil
+}
+
+// Run pushes the metrics at the configured interval until ctx is done
+func (p *Pusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Push(ctx); err != nil {
+			log.Errorf("Couldn't push metrics to %s, err: %s", p.opts.URL, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Push scrapes the target and replaces the metrics of its group on the Pushgateway
+func (p *Pusher) Push(ctx context.Context) error {
+	p.pushes.Inc()
+	if err := p.push(ctx); err != nil {
+		p.pushFailures.Inc()
+		return err
+	}
+	return nil
+}
+
+func (p *Pusher) push(ctx context.Context) error {
+	mfs, err := p.e.options.Registry.Gather()
+	if err != nil {
+		if len(mfs) == 0 {
+			return err
+		}
+		log.Errorf("Couldn't gather all metrics, err: %s", err)
+	}
+
+	grouping := p.grouping(mfs)
+	stripGroupingLabels(mfs, grouping)
+
+	pusher := push.New(p.opts.URL, p.opts.Job).
+		Client(p.client).
+		Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, nil }))
+	for name, value := range grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	if p.opts.Username != "" {
+		pusher = pusher.BasicAuth(p.opts.Username, p.opts.Password)
+	}
+	return pusher.PushContext(ctx)
+}
+
+/*
+grouping returns the grouping labels of the target:
+
+  - instance is the host:port of the target
+  - role is the role reported by INFO, with GroupByRole set
+  - cluster is the cluster of a controller:// target
+
+a derived label is left out if a metric has a label of the same name with a different value,
+e.g. the role of the replicas discovered through a sentinel
+*/
+func (p *Pusher) grouping(mfs []*dto.MetricFamily) map[string]string {
+	derived := map[string]string{}
+	if instance := targetInstance(p.e.kvrocksAddr); instance != "" {
+		derived["instance"] = instance
+	}
+	if p.opts.GroupByRole {
+		if role := labelValue(mfs, prometheus.BuildFQName(p.e.options.Namespace, "", "instance_info"), "role"); role != "" {
+			derived["role"] = role
+		}
+	}
+	if cluster := targetCluster(p.e.kvrocksAddr); cluster != "" {
+		derived["cluster"] = cluster
+	}
+
+	res := map[string]string{}
+	for name, value := range derived {
+		if hasConflictingLabel(mfs, name, value) {
+			log.Debugf("not grouping by %s=%s, it conflicts with the labels of the metrics", name, value)
+			continue
+		}
+		res[name] = value
+	}
+	for name, value := range p.opts.Grouping {
+		res[name] = value
+	}
+	return res
+}
+
+func targetInstance(addr string) string {
+	if !strings.Contains(addr, "://") {
+		addr = "redis://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func targetCluster(addr string) string {
+	if !strings.HasPrefix(addr, "controller://") {
+		return ""
+	}
+	path, err := discoveryService(addr)
+	if err != nil {
+		return ""
+	}
+	return strings.Split(path, "/")[1]
+}
+
+func labelValue(mfs []*dto.MetricFamily, metric, label string) string {
+	for _, mf := range mfs {
+		if mf.GetName() != metric {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == label {
+					return l.GetValue()
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func hasConflictingLabel(mfs []*dto.MetricFamily, name, value string) bool {
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == name && l.GetValue() != value {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// stripGroupingLabels removes the labels the Pushgateway adds back from the grouping labels,
+// it refuses metrics that already have a grouping label
+func stripGroupingLabels(mfs []*dto.MetricFamily, grouping map[string]string) {
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			lbls := m.Label[:0]
+			for _, l := range m.GetLabel() {
+				if value, ok := grouping[l.GetName()]; ok && value == l.GetValue() {
+					continue
+				}
+				lbls = append(lbls, l)
+			}
+			m.Label = lbls
+		}
+	}
+}
+
+// ParseGrouping parses grouping labels like "dc=eu-west,cluster=orders"
+func ParseGrouping(s string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid grouping label %q, expected name=value", pair)
+		}
+		res[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return res, nil
+}
@@ -0,0 +1,274 @@
+package exporter
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+type pushedRequest struct {
+	method string
+	path   string
+	user   string
+	pass   string
+	body   string
+}
+
+// newTestPushgateway records the pushes and answers with status
+func newTestPushgateway(tls bool, status int) (*httptest.Server, func() []pushedRequest) {
+	var mu sync.Mutex
+	var reqs []pushedRequest
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		user, pass, _ := r.BasicAuth()
+		mu.Lock()
+		reqs = append(reqs, pushedRequest{method: r.Method, path: r.URL.Path, user: user, pass: pass, body: string(body)})
+		mu.Unlock()
+		w.WriteHeader(status)
+	})
+
+	ts := httptest.NewUnstartedServer(h)
+	// the TLS test makes a push with an untrusted certificate on purpose
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	if tls {
+		ts.StartTLS()
+	} else {
+		ts.Start()
+	}
+	return ts, func() []pushedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]pushedRequest(nil), reqs...)
+	}
+}
+
+func TestPush(t *testing.T) {
+	pgw, pushed := newTestPushgateway(false, http.StatusOK)
+	defer pgw.Close()
+
+	e, _ := NewKvrocksExporter("kvrocks://localhost:6666", Options{Namespace: "test", ReplayBundle: testCaptureBundle(t), Registry: prometheus.NewRegistry()})
+	p, err := NewPusher(e, PushOptions{URL: pgw.URL, Username: "user", Password: "pwd", Grouping: map[string]string{"dc": "eu"}})
+	if err != nil {
+		t.Fatalf("NewPusher() err: %s", err)
+	}
+	if err := p.Push(context.Background()); err != nil {
+		t.Fatalf("Push() err: %s", err)
+	}
+
+	reqs := pushed()
+	if len(reqs) != 1 {
+		t.Fatalf("want 1 push, got: %d", len(reqs))
+	}
+	r := reqs[0]
+	if r.method != http.MethodPut {
+		t.Errorf("want PUT, got: %s", r.method)
+	}
+	for _, want := range []string{"/metrics/job/kvrocks_exporter", "/instance/localhost:6666", "/dc/eu"} {
+		if !strings.Contains(r.path, want) {
+			t.Errorf("want path to include %s, have: %s", want, r.path)
+		}
+	}
+	if r.user != "user" || r.pass != "pwd" {
+		t.Errorf("want basic auth user:pwd, got: %s:%s", r.user, r.pass)
+	}
+	if !strings.Contains(r.body, "test_up") || !strings.Contains(r.body, "test_instance_info") {
+		t.Errorf("want the metrics to be pushed, have:\n%s", r.body)
+	}
+	// the role changes with failovers, it's kept on the series instead of in the group by default
+	if strings.Contains(r.path, "/role/") {
+		t.Errorf("want the role not to be in the group, have: %s", r.path)
+	}
+	if _, ok := metricValue(decodePushedMetrics(t, r.body), "test_instance_info", map[string]string{"role": "master"}); !ok {
+		t.Errorf("want test_instance_info with role=\"master\" to be pushed")
+	}
+	if testutil.ToFloat64(p.pushes) != 1 || testutil.ToFloat64(p.pushFailures) != 0 {
+		t.Errorf("want 1 push and no failures, got: %v / %v", testutil.ToFloat64(p.pushes), testutil.ToFloat64(p.pushFailures))
+	}
+}
+
+func TestPushGroupByRole(t *testing.T) {
+	pgw, pushed := newTestPushgateway(false, http.StatusOK)
+	defer pgw.Close()
+
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", ReplayBundle: testCaptureBundle(t), Registry: prometheus.NewRegistry()})
+	p, err := NewPusher(e, PushOptions{URL: pgw.URL, GroupByRole: true})
+	if err != nil {
+		t.Fatalf("NewPusher() err: %s", err)
+	}
+	if err := p.Push(context.Background()); err != nil {
+		t.Fatalf("Push() err: %s", err)
+	}
+
+	r := pushed()[0]
+	if !strings.Contains(r.path, "/role/master") {
+		t.Errorf("want path to include /role/master, have: %s", r.path)
+	}
+	// the Pushgateway adds the grouping labels back
+	mfs := decodePushedMetrics(t, r.body)
+	if _, ok := metricValue(mfs, "test_instance_info", nil); !ok {
+		t.Fatalf("want test_instance_info to be pushed")
+	}
+	for _, l := range mfs["test_instance_info"].GetMetric()[0].GetLabel() {
+		if l.GetName() == "role" {
+			t.Errorf("want the role label to be left to the grouping, have: %s", l.GetValue())
+		}
+	}
+}
+
+// decodePushedMetrics decodes the delimited protobuf body of a push
+func decodePushedMetrics(t *testing.T, body string) map[string]*dto.MetricFamily {
+	mfs := map[string]*dto.MetricFamily{}
+	dec := expfmt.NewDecoder(strings.NewReader(body), expfmt.NewFormat(expfmt.TypeProtoDelim))
+	for {
+		mf := &dto.MetricFamily{}
+		if err := dec.Decode(mf); err == io.EOF {
+			return mfs
+		} else if err != nil {
+			t.Fatalf("couldn't decode pushed metrics: %s", err)
+		}
+		mfs[mf.GetName()] = mf
+	}
+}
+
+func TestPushFailures(t *testing.T) {
+	pgw, _ := newTestPushgateway(false, http.StatusInternalServerError)
+	defer pgw.Close()
+
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", ReplayBundle: testCaptureBundle(t), Registry: prometheus.NewRegistry()})
+	p, err := NewPusher(e, PushOptions{URL: pgw.URL})
+	if err != nil {
+		t.Fatalf("NewPusher() err: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.Push(context.Background()); err == nil {
+			t.Errorf("expected error for a failing Pushgateway")
+		}
+	}
+	if got := testutil.ToFloat64(p.pushFailures); got != 2 {
+		t.Errorf("want 2 push failures, got: %v", got)
+	}
+
+	if _, err := NewPusher(e, PushOptions{}); err == nil {
+		t.Errorf("expected error without a Pushgateway URL")
+	}
+	if _, err := NewPusher(&Exporter{}, PushOptions{URL: pgw.URL}); err == nil {
+		t.Errorf("expected error without a registry")
+	}
+}
+
+func TestPushTLS(t *testing.T) {
+	pgw, pushed := newTestPushgateway(true, http.StatusAccepted)
+	defer pgw.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pgw.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatalf("couldn't write CA: %s", err)
+	}
+
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", ReplayBundle: testCaptureBundle(t), Registry: prometheus.NewRegistry()})
+
+	// without the CA the certificate of the stand-in isn't trusted
+	p, _ := NewPusher(e, PushOptions{URL: pgw.URL})
+	if err := p.Push(context.Background()); err == nil {
+		t.Errorf("expected error for an untrusted certificate")
+	}
+
+	e, _ = NewKvrocksExporter("localhost:6666", Options{Namespace: "test", ReplayBundle: testCaptureBundle(t), Registry: prometheus.NewRegistry()})
+	p, err := NewPusher(e, PushOptions{URL: pgw.URL, CaCertFile: caFile})
+	if err != nil {
+		t.Fatalf("NewPusher() err: %s", err)
+	}
+	if err := p.Push(context.Background()); err != nil {
+		t.Fatalf("Push() err: %s", err)
+	}
+	if len(pushed()) != 1 {
+		t.Errorf("want 1 successful push, got: %d", len(pushed()))
+	}
+}
+
+func TestPushRun(t *testing.T) {
+	pgw, pushed := newTestPushgateway(false, http.StatusOK)
+	defer pgw.Close()
+
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", ReplayBundle: testCaptureBundle(t), Registry: prometheus.NewRegistry()})
+	p, _ := NewPusher(e, PushOptions{URL: pgw.URL, Interval: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(pushed()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if len(pushed()) < 3 {
+		t.Errorf("want the metrics to be pushed repeatedly, got: %d pushes", len(pushed()))
+	}
+}
+
+func TestTargetGrouping(t *testing.T) {
+	for _, tst := range []struct {
+		addr     string
+		instance string
+		cluster  string
+	}{
+		{addr: "kvrocks://localhost:6666", instance: "localhost:6666"},
+		{addr: "redis://:pwd@10.0.0.1:6666", instance: "10.0.0.1:6666"},
+		{addr: "10.0.0.1:6666", instance: "10.0.0.1:6666"},
+		{addr: "controller://ctrl:9379/ns1/orders/0", instance: "ctrl:9379", cluster: "orders"},
+	} {
+		if got := targetInstance(tst.addr); got != tst.instance {
+			t.Errorf("targetInstance(%s) got: %s, want: %s", tst.addr, got, tst.instance)
+		}
+		if got := targetCluster(tst.addr); got != tst.cluster {
+			t.Errorf("targetCluster(%s) got: %s, want: %s", tst.addr, got, tst.cluster)
+		}
+	}
+
+	// replicas discovered through a sentinel report another role than their master
+	r := prometheus.NewRegistry()
+	info := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_instance_info"}, []string{"role"})
+	info.WithLabelValues("master").Set(1)
+	info.WithLabelValues("slave").Set(1)
+	r.MustRegister(info)
+	mfs, _ := r.Gather()
+	if !hasConflictingLabel(mfs, "role", "master") {
+		t.Errorf("want role=master to conflict with role=slave")
+	}
+	if hasConflictingLabel(mfs, "instance", "localhost:6666") {
+		t.Errorf("want no conflict for a label the metrics don't have")
+	}
+
+	grouping, err := ParseGrouping("dc=eu, cluster=orders,")
+	if err != nil {
+		t.Fatalf("ParseGrouping() err: %s", err)
+	}
+	if want := map[string]string{"dc": "eu", "cluster": "orders"}; !reflect.DeepEqual(grouping, want) {
+		t.Errorf("ParseGrouping() got: %v, want: %v", grouping, want)
+	}
+	if _, err := ParseGrouping("dc"); err == nil {
+		t.Errorf("expected error for a label without value")
+	}
+}
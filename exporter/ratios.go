@@ -0,0 +1,67 @@
+package exporter
+
+import (
+	"strconv"
+
+	"github.com/RocksLabs/kvrocks_exporter/info"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// block cache hit and miss counters of INFO by the type label of block_cache_hit_ratio
+var blockCacheTypes = []struct{ typ, prefix string }{
+	{typ: "all", prefix: "block_cache_"},
+	{typ: "data", prefix: "block_cache_data_"},
+	{typ: "index", prefix: "block_cache_index_"},
+	{typ: "filter", prefix: "block_cache_filter_"},
+}
+
+/*
+extractDerivedRatioMetrics exports ratios of INFO fields that are otherwise computed in PromQL. The hit ratios
+are the ones since the start of the instance, ratios with a denominator of 0, e.g. of an instance without
+max_db_size, aren't exported.
+*/
+func (e *Exporter) extractDerivedRatioMetrics(ch chan<- prometheus.Metric, snap *info.Snapshot) {
+	value := func(key string) (float64, bool) {
+		s, ok := snap.Lookup(key)
+		if !ok {
+			return 0, false
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		return v, err == nil
+	}
+	ratio := func(name string, num, denom float64, lbls ...string) {
+		if denom > 0 {
+			e.registerConstMetricGauge(ch, name, num/denom, lbls...)
+		}
+	}
+
+	if hits, ok := value("keyspace_hits"); ok {
+		if misses, ok := value("keyspace_misses"); ok {
+			ratio("keyspace_hit_ratio", hits, hits+misses)
+		}
+	}
+
+	for _, t := range blockCacheTypes {
+		hits, ok := value(t.prefix + "hit")
+		if !ok {
+			continue
+		}
+		if misses, ok := value(t.prefix + "miss"); ok {
+			ratio("block_cache_hit_ratio", hits, hits+misses, t.typ)
+		}
+	}
+
+	for _, r := range []struct{ name, num, denom string }{
+		{name: "disk_utilization_ratio", num: "used_disk_size", denom: "disk_capacity"},
+		{name: "db_size_utilization_ratio", num: "used_db_size", denom: "max_db_size"},
+		{name: "clients_utilization_ratio", num: "connected_clients", denom: "maxclients"},
+	} {
+		num, ok := value(r.num)
+		if !ok {
+			continue
+		}
+		if denom, ok := value(r.denom); ok {
+			ratio(r.name, num, denom)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package exporter
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDerivedRatioMetrics(t *testing.T) {
+	infoAll := strings.Replace(loadTestInfo(t), "max_db_size:0", "max_db_size:96543270912", 1)
+
+	e, _ := NewKvrocksExporter("", Options{Namespace: "test", DerivedRatios: true})
+	mfs := gatherInfoMetrics(t, e, infoAll)
+	for _, tst := range []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{name: "test_keyspace_hit_ratio", want: 81726354.0 / (81726354 + 1827364)},
+		{name: "test_block_cache_hit_ratio", labels: map[string]string{"type": "all"}, want: 918273645.0 / (918273645 + 18273645)},
+		{name: "test_block_cache_hit_ratio", labels: map[string]string{"type": "data"}, want: 818273645.0 / (818273645 + 17273645)},
+		{name: "test_block_cache_hit_ratio", labels: map[string]string{"type": "index"}, want: 50000000.0 / 50500000},
+		{name: "test_block_cache_hit_ratio", labels: map[string]string{"type": "filter"}, want: 50000000.0 / 50500000},
+		{name: "test_disk_utilization_ratio", want: 61827364512.0 / 536870912000},
+		{name: "test_db_size_utilization_ratio", want: 0.5},
+		{name: "test_clients_utilization_ratio", want: 42.0 / 10000},
+	} {
+		got, ok := metricValue(mfs, tst.name, tst.labels)
+		if !ok || math.Abs(got-tst.want) > 1e-9 {
+			t.Errorf("%s%v got: %v (exported: %v), want: %v", tst.name, tst.labels, got, ok, tst.want)
+		}
+	}
+
+	// no ratio without max_db_size, and none at all when turned off
+	mfs = gatherInfoMetrics(t, e, loadTestInfo(t))
+	if _, ok := mfs["test_db_size_utilization_ratio"]; ok {
+		t.Errorf("db_size_utilization_ratio shouldn't be exported without max_db_size")
+	}
+	e, _ = NewKvrocksExporter("", Options{Namespace: "test"})
+	mfs = gatherInfoMetrics(t, e, infoAll)
+	for name := range mfs {
+		if strings.HasSuffix(name, "_hit_ratio") || strings.HasSuffix(name, "_utilization_ratio") {
+			t.Errorf("%s shouldn't be exported without DerivedRatios", name)
+		}
+	}
+}
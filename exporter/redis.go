@@ -32,6 +32,11 @@ func (e *Exporter) configureOptions(uri string) ([]redis.DialOption, error) {
 }
 
 func (e *Exporter) connectToKvrocks() (redis.Conn, error) {
+	if e.options.ReplayBundle != nil {
+		log.Debugf("Replaying capture bundle of %s", e.options.ReplayBundle.Addr)
+		return newReplayConn(e.options.ReplayBundle), nil
+	}
+
 	uri := e.kvrocksAddr
 	uri = strings.Replace(uri, "kvrocks://", "redis://", 1)
 	if !strings.Contains(uri, "://") {
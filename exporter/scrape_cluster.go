@@ -0,0 +1,183 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const clusterSlots = 16384
+
+// clusterCollector scrapes all nodes of the cluster of the seed exporter
+type clusterCollector struct {
+	e *Exporter
+}
+
+// Describe sends no descriptions, the nodes are only known once they are discovered
+func (c clusterCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c clusterCollector) Collect(ch chan<- prometheus.Metric) {
+	c.e.collectCluster(ch)
+}
+
+// clusterNodeRole returns master or slave
+func clusterNodeRole(n clusterNode) string {
+	if n.hasFlag("master") {
+		return "master"
+	}
+	return "slave"
+}
+
+// clusterNodeShard returns the id of the master of the node's shard
+func clusterNodeShard(n clusterNode) string {
+	if clusterNodeRole(n) == "master" {
+		return n.id
+	}
+	return n.master
+}
+
+func isFailingClusterNode(n clusterNode) bool {
+	return n.hasFlag("fail") || n.hasFlag("fail?") || n.hasFlag("noaddr") || n.link != "connected"
+}
+
+/*
+clusterSlotsCovered returns the number of slots served by masters that aren't failing.
+Slots being imported or migrated like [42-<-<node id>] and [42->-<node id>] are still owned by the
+node listed with the slot number itself.
+*/
+func clusterSlotsCovered(nodes []clusterNode) int {
+	var covered [clusterSlots]bool
+	n := 0
+	for _, node := range nodes {
+		if clusterNodeRole(node) != "master" || isFailingClusterNode(node) {
+			continue
+		}
+		for _, r := range node.slots {
+			if strings.HasPrefix(r, "[") {
+				continue
+			}
+			start, end, ok := parseSlotRange(r)
+			if !ok || end >= clusterSlots {
+				continue
+			}
+			for slot := start; slot <= end; slot++ {
+				if !covered[slot] {
+					covered[slot] = true
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// clusterMastersWithoutReplicas returns the number of masters without a replica that isn't failing
+func clusterMastersWithoutReplicas(nodes []clusterNode) int {
+	healthyReplicas := map[string]int{}
+	for _, n := range nodes {
+		if clusterNodeRole(n) == "slave" && !isFailingClusterNode(n) {
+			healthyReplicas[n.master]++
+		}
+	}
+
+	res := 0
+	for _, n := range nodes {
+		if clusterNodeRole(n) == "master" && healthyReplicas[n.id] == 0 {
+			res++
+		}
+	}
+	return res
+}
+
+func (e *Exporter) clusterNodes() ([]clusterNode, error) {
+	c, err := e.connectToKvrocks()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	nodes, err := redis.String(doRedisCmd(c, "CLUSTER", "NODES"))
+	if err != nil {
+		return nil, err
+	}
+	return parseClusterNodes(nodes), nil
+}
+
+// clusterNodeURI returns the URI of a node with the scheme of the seed, e.g. to keep TLS
+func (e *Exporter) clusterNodeURI(addr string) string {
+	scheme := "redis"
+	if idx := strings.Index(e.kvrocksAddr, "://"); idx > 0 {
+		scheme = strings.Replace(e.kvrocksAddr[:idx], "kvrocks", "redis", 1)
+	}
+	return scheme + "://" + addr
+}
+
+// collectCluster discovers the nodes of the cluster of the seed e.kvrocksAddr with CLUSTER NODES and
+// scrapes them with up to Options.ClusterScrapeWorkers at a time. The series of every node carry the
+// node_id, role and shard (the id of the shard's master) labels.
+func (e *Exporter) collectCluster(ch chan<- prometheus.Metric) {
+	nodes, err := e.clusterNodes()
+	if err != nil {
+		log.Errorf("Couldn't get the nodes of the cluster of %s, err: %s", e.kvrocksAddr, err)
+		e.registerConstMetricGauge(ch, "exporter_last_scrape_error", 1.0, fmt.Sprintf("%s", err))
+		e.registerConstMetricGauge(ch, "up", 0)
+		return
+	}
+
+	workers := e.options.ClusterScrapeWorkers
+	if workers <= 0 {
+		workers = 8
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	nodesUp := 0
+	queue := make(chan clusterNode)
+	for i := 0; i < workers && i < len(nodes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range queue {
+				if e.collectClusterNode(ch, n) {
+					mu.Lock()
+					nodesUp++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, n := range nodes {
+		queue <- n
+	}
+	close(queue)
+	wg.Wait()
+
+	e.registerConstMetricGauge(ch, "cluster_nodes", float64(len(nodes)))
+	e.registerConstMetricGauge(ch, "cluster_nodes_up", float64(nodesUp))
+	e.registerConstMetricGauge(ch, "cluster_slots_covered", float64(clusterSlotsCovered(nodes)))
+	e.registerConstMetricGauge(ch, "cluster_masters_without_replicas", float64(clusterMastersWithoutReplicas(nodes)))
+}
+
+func (e *Exporter) collectClusterNode(ch chan<- prometheus.Metric, n clusterNode) bool {
+	opts := e.options
+	opts.Registry = nil
+	opts.IsCluster = true
+	opts.ConstLabels = mergeLabels(opts.ConstLabels, prometheus.Labels{
+		"node_id": n.id,
+		"role":    clusterNodeRole(n),
+		"shard":   clusterNodeShard(n),
+	})
+
+	addr := e.clusterNodeURI(n.addr)
+	log.Debugf("scraping cluster node %s %s", n.id, addr)
+	node, err := e.newChildExporter(addr, opts)
+	if err != nil {
+		log.Errorf("NewKvrocksExporter( %s ) err: %s", addr, err)
+		return false
+	}
+	return node.collectTarget(ch)
+}
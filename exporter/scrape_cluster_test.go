@@ -0,0 +1,86 @@
+package exporter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const testClusterNodes = `07c37dfeb235213a872192d90877d0cd55635b91 127.0.0.1:30004@31004 slave e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 0 1426238317239 4 connected
+67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1 127.0.0.1:30002@31002 master - 0 1426238316232 2 connected 5461-10922
+292f8b365bb7edb5e285caf0b7e6ddc7265d2f4f 127.0.0.1:30003@31003 master - 0 1426238318243 3 connected 10923-16383 [16383-<-67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1]
+6ec23923021cf3ffec47632106199cb7f496ce01 127.0.0.1:30005@31005 slave,fail 67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1 0 1426238316232 5 disconnected
+e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:30001@31001 myself,master - 0 0 1 connected 0-5460
+`
+
+func TestClusterSlotsCovered(t *testing.T) {
+	nodes := parseClusterNodes(testClusterNodes)
+	if got := clusterSlotsCovered(nodes); got != clusterSlots {
+		t.Errorf("clusterSlotsCovered() got: %d, want: %d", got, clusterSlots)
+	}
+
+	nodes[1].flags = append(nodes[1].flags, "fail")
+	if got, want := clusterSlotsCovered(nodes), clusterSlots-(10922-5461+1); got != want {
+		t.Errorf("clusterSlotsCovered() with a failing master got: %d, want: %d", got, want)
+	}
+}
+
+func TestClusterMastersWithoutReplicas(t *testing.T) {
+	nodes := parseClusterNodes(testClusterNodes)
+	// only the replica of 30001 is healthy
+	if got := clusterMastersWithoutReplicas(nodes); got != 2 {
+		t.Errorf("clusterMastersWithoutReplicas() got: %d, want: 2", got)
+	}
+
+	for _, n := range nodes {
+		if got, want := clusterNodeShard(n), map[string]string{"master": n.id, "slave": n.master}[clusterNodeRole(n)]; got != want {
+			t.Errorf("clusterNodeShard(%s) got: %s, want: %s", n.addr, got, want)
+		}
+	}
+}
+
+func TestScrapeClusterHandler(t *testing.T) {
+	bundle := testCaptureBundle(t)
+	reply, _ := captureValue([]byte(testClusterNodes))
+	bundle.Replies = append(bundle.Replies, CapturedReply{Command: []string{"CLUSTER", "NODES"}, Reply: reply})
+
+	e, _ := NewKvrocksExporter("", Options{Namespace: "test", ReplayBundle: bundle, ClusterScrapeWorkers: 2, Registry: prometheus.NewRegistry()})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/scrape_cluster?seed=127.0.0.1:30001")
+	for _, want := range []string{
+		`test_up{node_id="e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca",role="master",shard="e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca"} 1`,
+		`test_up{node_id="07c37dfeb235213a872192d90877d0cd55635b91",role="slave",shard="e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca"} 1`,
+		`test_instance_info{`,
+		"test_cluster_nodes 5",
+		"test_cluster_nodes_up 5",
+		"test_cluster_slots_covered 16384",
+		"test_cluster_masters_without_replicas 2",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/scrape_cluster")
+	if err != nil {
+		t.Fatalf("http.Get() err: %s", err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(b), "'seed' parameter must be specified") {
+		t.Errorf("want 400 without seed, got: %d %s", resp.StatusCode, b)
+	}
+}
+
+func TestNewMetricDescrConstLabelClash(t *testing.T) {
+	d := newMetricDescr("test", "instance_info", "Information about the instance", []string{"role"}, prometheus.Labels{"role": "master", "shard": "s1"})
+	if !strings.Contains(d.String(), `constLabels: {shard="s1"}`) || !strings.Contains(d.String(), "variableLabels: {role}") {
+		t.Errorf("want the clashing const label to be dropped, got: %s", d)
+	}
+}
@@ -0,0 +1,260 @@
+package exporter
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultScriptTimeout = 5 * time.Second
+
+type luaScript struct {
+	name string
+	src  string
+	sha  string
+}
+
+func newLuaScripts(scripts map[string][]byte) []luaScript {
+	var res []luaScript
+	for name, src := range scripts {
+		sum := sha1.Sum(src)
+		res = append(res, luaScript{name: name, src: string(src), sha: hex.EncodeToString(sum[:])})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].name < res[j].name })
+	return res
+}
+
+type scriptValue struct {
+	name   string
+	labels []string // names and values alternating, sorted by name
+	value  float64
+}
+
+/*
+parseScriptMetricName parses the metric names returned by a script, either a plain name like
+quota_used or a name with labels like quota_used{team="search",kind=hourly}.
+Label values can't contain commas.
+*/
+func parseScriptMetricName(s string) (name string, labels []string, err error) {
+	name, rest, hasLabels := strings.Cut(s, "{")
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, fmt.Errorf("empty metric name in %q", s)
+	}
+	if !hasLabels {
+		return name, nil, nil
+	}
+	if !strings.HasSuffix(rest, "}") {
+		return "", nil, fmt.Errorf("missing } in %q", s)
+	}
+
+	type label struct{ name, value string }
+	var lbls []label
+	for _, pair := range strings.Split(strings.TrimSuffix(rest, "}"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		n, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(n) == "" {
+			return "", nil, fmt.Errorf("invalid label %q in %q", pair, s)
+		}
+		lbls = append(lbls, label{name: sanitizeMetricName(strings.TrimSpace(n)), value: strings.Trim(strings.TrimSpace(v), `"`)})
+	}
+	sort.Slice(lbls, func(i, j int) bool { return lbls[i].name < lbls[j].name })
+	for _, l := range lbls {
+		labels = append(labels, l.name, l.value)
+	}
+	return name, labels, nil
+}
+
+// parseScriptReply parses the flat array of name/value pairs returned by a script
+func parseScriptReply(reply interface{}) ([]scriptValue, error) {
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("expected name/value pairs, got %d elements", len(values))
+	}
+
+	var res []scriptValue
+	for i := 0; i < len(values); i += 2 {
+		s, err := redis.String(values[i], nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric name: %w", err)
+		}
+		name, labels, err := parseScriptMetricName(s)
+		if err != nil {
+			return nil, err
+		}
+		v, err := replyFloat(values[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %w", s, err)
+		}
+		res = append(res, scriptValue{name: sanitizeMetricName(name), labels: labels, value: v})
+	}
+	return res, nil
+}
+
+// scriptFamilies are the metrics returned by the scripts in a scrape, so the values of a script can't clash with
+// the ones of the scripts before it
+type scriptFamilies struct {
+	// label names by metric name
+	labels map[string]string
+}
+
+// check returns an error if the values of a script clash with a metric of the exporter, of a custom command or of
+// the scripts before it, and adds them to the families otherwise
+func (f *scriptFamilies) check(e *Exporter, values []scriptValue) error {
+	labels := map[string]string{}
+	series := map[string]bool{}
+	for _, v := range values {
+		if _, ok := e.metricDescriptions[v.name]; ok {
+			return fmt.Errorf("metric %s of the exporter can't be returned by a script", v.name)
+		}
+		for _, cc := range e.customCommands {
+			if sanitizeMetricName(cc.Name) == v.name {
+				return fmt.Errorf("metric %s of custom command %s can't be returned by a script", v.name, cc.Name)
+			}
+		}
+
+		names := []string{"script"}
+		key := []string{v.name}
+		for i := 0; i < len(v.labels); i += 2 {
+			if v.labels[i] == "script" {
+				return fmt.Errorf("metric %s has a script label", v.name)
+			}
+			names = append(names, v.labels[i])
+			key = append(key, v.labels[i]+"="+v.labels[i+1])
+		}
+		lbls := strings.Join(names, ",")
+		if prev, ok := f.labels[v.name]; ok && prev != lbls {
+			return fmt.Errorf("metric %s is returned with the labels %s by another script", v.name, prev)
+		}
+		if prev, ok := labels[v.name]; ok && prev != lbls {
+			return fmt.Errorf("metric %s is returned with the labels %s and %s", v.name, prev, lbls)
+		}
+		labels[v.name] = lbls
+
+		k := strings.Join(key, "\xff")
+		if series[k] {
+			return fmt.Errorf("metric %s is returned twice with the same labels", v.name)
+		}
+		series[k] = true
+	}
+
+	for name, lbls := range labels {
+		f.labels[name] = lbls
+	}
+	return nil
+}
+
+func isTimeoutErr(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// runScript runs s with EVALSHA, and with EVAL if the server doesn't have it cached yet
+func runScript(c redis.Conn, s luaScript, timeout time.Duration) (interface{}, error) {
+	reply, err := redis.DoWithTimeout(c, timeout, "EVALSHA", s.sha, 0)
+	if err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		reply, err = redis.DoWithTimeout(c, timeout, "EVAL", s.src, 0)
+	}
+	return reply, err
+}
+
+/*
+extractLuaScriptMetrics runs the scripts of Options.LuaScripts and exports the name/value pairs they return
+as gauges with a script label. The values of a script that clash with other metrics fail the script, a metric
+returned by several scripts needs the same labels in all of them. Kvrocks runs scripts on its worker threads, so the scripts run on their own
+connection with a read timeout of Options.ScriptTimeout. The exporter tries to stop scripts that time out
+with SCRIPT KILL.
+*/
+func (e *Exporter) extractLuaScriptMetrics(ch chan<- prometheus.Metric) {
+	timeout := e.options.ScriptTimeout
+	if timeout <= 0 {
+		timeout = defaultScriptTimeout
+	}
+
+	var c redis.Conn
+	defer func() {
+		if c != nil {
+			c.Close()
+		}
+	}()
+
+	families := &scriptFamilies{labels: map[string]string{}}
+	for _, s := range e.scripts {
+		// the connection is unusable after a timeout
+		if c != nil && c.Err() != nil {
+			c.Close()
+			c = nil
+		}
+		if c == nil {
+			var err error
+			if c, err = e.connectToKvrocks(); err != nil {
+				log.Errorf("Couldn't connect to run script %s, err: %s", s.name, err)
+				e.registerConstMetricGauge(ch, "script_success", 0, s.name)
+				c = nil
+				continue
+			}
+		}
+
+		start := time.Now()
+		reply, err := runScript(c, s, timeout)
+		e.registerConstMetricGauge(ch, "script_duration_seconds", time.Since(start).Seconds(), s.name)
+
+		var values []scriptValue
+		if err == nil {
+			values, err = parseScriptReply(reply)
+		}
+		if err == nil {
+			err = families.check(e, values)
+		}
+		if err != nil {
+			log.Errorf("Script %s failed, err: %s", s.name, err)
+			e.registerConstMetricGauge(ch, "script_success", 0, s.name)
+			if isTimeoutErr(err) {
+				e.killScript()
+			}
+			continue
+		}
+
+		e.registerConstMetricGauge(ch, "script_success", 1, s.name)
+		for _, v := range values {
+			names := []string{"script"}
+			lblValues := []string{s.name}
+			for i := 0; i < len(v.labels); i += 2 {
+				names = append(names, v.labels[i])
+				lblValues = append(lblValues, v.labels[i+1])
+			}
+			desc := newMetricDescr(e.options.Namespace, v.name, "Value returned by a Lua script", names, e.options.ConstLabels)
+			if m, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, v.value, lblValues...); err == nil {
+				ch <- m
+			} else {
+				log.Errorf("Invalid metric %s of script %s, err: %s", v.name, s.name, err)
+			}
+		}
+	}
+}
+
+// killScript stops the script running on the server, e.g. one that timed out
+func (e *Exporter) killScript() {
+	c, err := e.connectToKvrocks()
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	if _, err := doRedisCmd(c, "SCRIPT", "KILL"); err != nil {
+		log.Debugf("SCRIPT KILL err: %s", err)
+	}
+}
@@ -0,0 +1,161 @@
+package exporter
+
+import (
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestParseScriptMetricName(t *testing.T) {
+	for _, tst := range []struct {
+		s      string
+		name   string
+		labels []string
+		err    bool
+	}{
+		{s: "quota_used", name: "quota_used"},
+		{s: `quota_used{team="search",kind=hourly}`, name: "quota_used", labels: []string{"kind", "hourly", "team", "search"}},
+		{s: `quota_used{}`, name: "quota_used"},
+		{s: `quota_used{team="search"`, err: true},
+		{s: `quota_used{team}`, err: true},
+		{s: `{team="search"}`, err: true},
+	} {
+		name, labels, err := parseScriptMetricName(tst.s)
+		if (err != nil) != tst.err {
+			t.Errorf("parseScriptMetricName(%s) err: %v, want error: %v", tst.s, err, tst.err)
+			continue
+		}
+		if name != tst.name || !reflect.DeepEqual(labels, tst.labels) {
+			t.Errorf("parseScriptMetricName(%s) got: %s %v, want: %s %v", tst.s, name, labels, tst.name, tst.labels)
+		}
+	}
+
+	if _, err := parseScriptReply([]interface{}{[]byte("a"), int64(1), []byte("b")}); err == nil {
+		t.Errorf("expected error for an odd number of elements")
+	}
+	if _, err := parseScriptReply([]interface{}{[]byte("a"), []byte("many")}); err == nil {
+		t.Errorf("expected error for a value that isn't a number")
+	}
+}
+
+func TestLuaScriptMetrics(t *testing.T) {
+	scripts := map[string][]byte{
+		"quota.lua":   []byte(`return {"quota_used{team=search}", 12, "quota_limit", "100.5"}`),
+		"broken.lua":  []byte(`return redis.call("NOPE")`),
+		"clashes.lua": []byte(`return {"up", 1}`),
+		"command.lua": []byte(`return {"queue_length", 1}`),
+		"teams.lua":   []byte(`return {"quota_used{kind=hourly}", 1}`),
+		"twice.lua":   []byte(`return {"jobs{kind=a}", 1, "jobs{kind=a}", 2}`),
+	}
+	sha := map[string]string{}
+	for _, s := range newLuaScripts(scripts) {
+		sha[s.name] = s.sha
+	}
+
+	b := testCaptureBundle(t)
+	for _, r := range []struct {
+		cmd []string
+		v   interface{}
+	}{
+		{cmd: []string{"EVALSHA", sha["quota.lua"], "0"}, v: redis.Error("NOSCRIPT No matching script. Please use EVAL.")},
+		{cmd: []string{"EVAL", string(scripts["quota.lua"]), "0"}, v: []interface{}{[]byte("quota_used{team=search}"), int64(12), []byte("quota_limit"), []byte("100.5")}},
+		{cmd: []string{"EVALSHA", sha["broken.lua"], "0"}, v: redis.Error("ERR Unknown Redis command called from Lua script")},
+		{cmd: []string{"EVALSHA", sha["clashes.lua"], "0"}, v: []interface{}{[]byte("up"), int64(1)}},
+		{cmd: []string{"EVALSHA", sha["command.lua"], "0"}, v: []interface{}{[]byte("queue_length"), int64(1)}},
+		{cmd: []string{"EVALSHA", sha["teams.lua"], "0"}, v: []interface{}{[]byte("quota_used{kind=hourly}"), int64(1)}},
+		{cmd: []string{"EVALSHA", sha["twice.lua"], "0"}, v: []interface{}{[]byte("jobs{kind=a}"), int64(1), []byte("jobs{kind=a}"), int64(2)}},
+	} {
+		val, err := captureValue(r.v)
+		if err != nil {
+			t.Fatalf("captureValue() err: %s", err)
+		}
+		b.Replies = append(b.Replies, CapturedReply{Command: r.cmd, Reply: val})
+	}
+
+	e, err := NewKvrocksExporter("localhost:6666", Options{
+		Namespace:      "test",
+		LuaScripts:     scripts,
+		CustomCommands: []CommandConfig{{Name: "queue_length", Command: []string{"LLEN", "queue"}}},
+		ReplayBundle:   b,
+		Registry:       prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatalf("NewKvrocksExporter() err: %s", err)
+	}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/metrics")
+	for _, want := range []string{
+		`test_quota_used{script="quota.lua",team="search"} 12`,
+		`test_quota_limit{script="quota.lua"} 100.5`,
+		`test_script_success{script="quota.lua"} 1`,
+		`test_script_success{script="broken.lua"} 0`,
+		`test_script_success{script="clashes.lua"} 0`,
+		// the name of a custom command, other labels than quota.lua and the same series twice
+		`test_script_success{script="command.lua"} 0`,
+		`test_script_success{script="teams.lua"} 0`,
+		`test_script_success{script="twice.lua"} 0`,
+		`test_script_duration_seconds{script="quota.lua"}`,
+		`test_up 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+}
+
+func TestLuaScriptTimeout(t *testing.T) {
+	// a server that accepts connections but never replies, like one busy running a script
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() err: %s", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	e, _ := NewKvrocksExporter(l.Addr().String(), Options{
+		Namespace:          "test",
+		LuaScripts:         map[string][]byte{"a.lua": []byte("return {}"), "b.lua": []byte("return {}")},
+		ScriptTimeout:      50 * time.Millisecond,
+		ConnectionTimeouts: 50 * time.Millisecond,
+	})
+
+	ch := make(chan prometheus.Metric, 100)
+	start := time.Now()
+	e.extractLuaScriptMetrics(ch)
+	close(ch)
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("want the scripts to time out, took: %s", took)
+	}
+
+	failed := 0
+	for m := range ch {
+		if !strings.Contains(m.Desc().String(), `"test_script_success"`) {
+			continue
+		}
+		var pb dto.Metric
+		_ = m.Write(&pb)
+		if pb.GetGauge().GetValue() == 0 {
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Errorf("want both scripts to fail, got: %d", failed)
+	}
+}
@@ -0,0 +1,84 @@
+package exporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+func isUnknownCommandErr(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "unknown command")
+}
+
+// replyFloat converts integer, bulk and status replies to float64
+func replyFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), nil
+	case []byte:
+		return strconv.ParseFloat(string(v), 64)
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("unexpected reply type %T", v)
+}
+
+/*
+extractSearchMetrics exports the indexes of the search module listed by FT._LIST with the
+document count, indexing state, indexing failures and field count reported by FT.INFO.
+The FT.INFO fields follow RediSearch, fields a server doesn't report are skipped.
+
+Servers without search module answer FT._LIST with an unknown command error, the collector is
+disabled for the lifetime of the exporter then.
+*/
+func (e *Exporter) extractSearchMetrics(ch chan<- prometheus.Metric, c redis.Conn) {
+	if e.searchUnsupported {
+		return
+	}
+
+	indexes, err := redis.Strings(doRedisCmd(c, "FT._LIST"))
+	if err != nil {
+		if isUnknownCommandErr(err) {
+			log.Infof("%s doesn't support search indexes, not checking them anymore", e.kvrocksAddr)
+			e.searchUnsupported = true
+			return
+		}
+		log.Errorf("Couldn't list search indexes, err: %s", err)
+		return
+	}
+	e.registerConstMetricGauge(ch, "search_indexes", float64(len(indexes)))
+
+	for _, index := range indexes {
+		info, err := replyMap(doRedisCmd(c, "FT.INFO", index))
+		if err != nil {
+			log.Errorf("Couldn't get info of search index %s, err: %s", index, err)
+			continue
+		}
+
+		if v, err := replyFloat(info["num_docs"]); err == nil {
+			e.registerConstMetricGauge(ch, "search_index_documents", v, index)
+		}
+		if v, err := replyFloat(info["indexing"]); err == nil {
+			e.registerConstMetricGauge(ch, "search_index_indexing", v, index)
+		}
+		if v, err := replyFloat(info["percent_indexed"]); err == nil {
+			e.registerConstMetricGauge(ch, "search_index_indexed_ratio", v, index)
+		}
+		for _, field := range []string{"hash_indexing_failures", "indexing_failures"} {
+			if v, err := replyFloat(info[field]); err == nil {
+				e.registerConstMetricGauge(ch, "search_index_indexing_failures", v, index)
+				break
+			}
+		}
+		for _, field := range []string{"fields", "attributes"} {
+			if fields, err := redis.Values(info[field], nil); err == nil {
+				e.registerConstMetricGauge(ch, "search_index_fields", float64(len(fields)), index)
+				break
+			}
+		}
+	}
+}
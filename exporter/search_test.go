@@ -0,0 +1,77 @@
+package exporter
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSearchMetrics(t *testing.T) {
+	b := testCaptureBundle(t)
+	for _, r := range []struct {
+		cmd []string
+		v   interface{}
+	}{
+		{cmd: []string{"FT._LIST"}, v: []interface{}{[]byte("idx:users"), []byte("idx:orders")}},
+		{cmd: []string{"FT.INFO", "idx:users"}, v: []interface{}{
+			[]byte("index_name"), []byte("idx:users"),
+			[]byte("num_docs"), []byte("1200"),
+			[]byte("indexing"), int64(1),
+			[]byte("percent_indexed"), []byte("0.75"),
+			[]byte("hash_indexing_failures"), int64(3),
+			[]byte("attributes"), []interface{}{[]interface{}{[]byte("identifier"), []byte("name")}, []interface{}{[]byte("identifier"), []byte("age")}},
+		}},
+		{cmd: []string{"FT.INFO", "idx:orders"}, v: redis.Error("ERR index not found")},
+	} {
+		val, err := captureValue(r.v)
+		if err != nil {
+			t.Fatalf("captureValue() err: %s", err)
+		}
+		b.Replies = append(b.Replies, CapturedReply{Command: r.cmd, Reply: val})
+	}
+
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", CheckSearchIndexes: true, ReplayBundle: b, Registry: prometheus.NewRegistry()})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/metrics")
+	for _, want := range []string{
+		`test_search_indexes 2`,
+		`test_search_index_documents{index="idx:users"} 1200`,
+		`test_search_index_indexing{index="idx:users"} 1`,
+		`test_search_index_indexed_ratio{index="idx:users"} 0.75`,
+		`test_search_index_indexing_failures{index="idx:users"} 3`,
+		`test_search_index_fields{index="idx:users"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `index="idx:orders"`) {
+		t.Errorf("want no metrics for an index without info, have:\n%s", body)
+	}
+}
+
+func TestSearchUnsupported(t *testing.T) {
+	b := testCaptureBundle(t)
+	val, _ := captureValue(redis.Error("ERR unknown command `FT._LIST`"))
+	b.Replies = append(b.Replies, CapturedReply{Command: []string{"FT._LIST"}, Reply: val})
+
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", CheckSearchIndexes: true, ReplayBundle: b, Registry: prometheus.NewRegistry()})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/metrics")
+	if strings.Contains(body, "test_search_") {
+		t.Errorf("want no search metrics, have:\n%s", body)
+	}
+	if !e.searchUnsupported {
+		t.Errorf("want the search collector to be disabled")
+	}
+	if !strings.Contains(body, "test_up 1") {
+		t.Errorf("want the instance to be up, have:\n%s", body)
+	}
+}
@@ -0,0 +1,152 @@
+package exporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultMaxStreamKeys = 100
+
+/*
+streamKeys returns the keys matching the patterns of Options.CheckStreams, at most Options.MaxStreamKeys of them.
+Keys that aren't streams are skipped.
+*/
+func (e *Exporter) streamKeys(c redis.Conn) (keys []string, truncated bool) {
+	max := e.options.MaxStreamKeys
+	if max <= 0 {
+		max = defaultMaxStreamKeys
+	}
+	return scanKeys(c, splitKeyPatterns(e.options.CheckStreams), "stream", max)
+}
+
+// replyMap returns the field/value pairs of a reply like the one of XINFO STREAM as map
+func replyMap(reply interface{}, err error) (map[string]interface{}, error) {
+	values, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("invalid reply, odd number of elements: %d", len(values))
+	}
+
+	res := make(map[string]interface{}, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		field, err := redis.String(values[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		res[field] = values[i+1]
+	}
+	return res, nil
+}
+
+// parseStreamIDMillis returns the milliseconds part of a stream ID like 1700000000000-0
+func parseStreamIDMillis(id string) (int64, bool) {
+	ms, _, _ := strings.Cut(id, "-")
+	v, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+func (e *Exporter) extractStreamMetrics(ch chan<- prometheus.Metric, c redis.Conn) {
+	keys, truncated := e.streamKeys(c)
+	var truncatedVal float64
+	if truncated {
+		log.Warnf("Not all stream keys were looked at or exported, exporting %d of them", len(keys))
+		truncatedVal = 1
+	}
+	e.registerConstMetricGauge(ch, "stream_keys_truncated", truncatedVal)
+
+	for _, key := range keys {
+		if err := e.extractStreamKeyMetrics(ch, c, key); err != nil {
+			log.Debugf("Couldn't get stream info of %s, err: %s", key, err)
+		}
+	}
+}
+
+func (e *Exporter) extractStreamKeyMetrics(ch chan<- prometheus.Metric, c redis.Conn, key string) error {
+	info, err := replyMap(doRedisCmd(c, "XINFO", "STREAM", key))
+	if err != nil {
+		return err
+	}
+
+	if length, err := redis.Int64(info["length"], nil); err == nil {
+		e.registerConstMetricGauge(ch, "stream_length", float64(length), key)
+	}
+	if groups, err := redis.Int64(info["groups"], nil); err == nil {
+		e.registerConstMetricGauge(ch, "stream_groups", float64(groups), key)
+	}
+	if id, err := redis.String(info["last-generated-id"], nil); err == nil {
+		if ms, ok := parseStreamIDMillis(id); ok {
+			e.registerConstMetricGauge(ch, "stream_last_generated_id_timestamp_seconds", float64(ms)/1e3, key)
+		}
+	}
+
+	groups, err := redis.Values(doRedisCmd(c, "XINFO", "GROUPS", key))
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		group, err := replyMap(g, nil)
+		if err != nil {
+			return err
+		}
+		name, err := redis.String(group["name"], nil)
+		if err != nil {
+			return err
+		}
+
+		if consumers, err := redis.Int64(group["consumers"], nil); err == nil {
+			e.registerConstMetricGauge(ch, "stream_group_consumers", float64(consumers), key, name)
+		}
+		if pending, err := redis.Int64(group["pending"], nil); err == nil {
+			e.registerConstMetricGauge(ch, "stream_group_pending", float64(pending), key, name)
+		}
+		// lag is nil if the server can't tell, e.g. after entries were deleted
+		if lag, err := redis.Int64(group["lag"], nil); err == nil {
+			e.registerConstMetricGauge(ch, "stream_group_lag", float64(lag), key, name)
+		}
+		if id, err := redis.String(group["last-delivered-id"], nil); err == nil {
+			if ms, ok := parseStreamIDMillis(id); ok {
+				e.registerConstMetricGauge(ch, "stream_group_last_delivered_id_age_seconds", time.Since(time.UnixMilli(ms)).Seconds(), key, name)
+			}
+		}
+
+		if err := e.extractStreamConsumerMetrics(ch, c, key, name); err != nil {
+			log.Debugf("Couldn't get consumers of group %s of stream %s, err: %s", name, key, err)
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) extractStreamConsumerMetrics(ch chan<- prometheus.Metric, c redis.Conn, key, group string) error {
+	consumers, err := redis.Values(doRedisCmd(c, "XINFO", "CONSUMERS", key, group))
+	if err != nil {
+		return err
+	}
+	for _, v := range consumers {
+		consumer, err := replyMap(v, nil)
+		if err != nil {
+			return err
+		}
+		name, err := redis.String(consumer["name"], nil)
+		if err != nil {
+			return err
+		}
+		if pending, err := redis.Int64(consumer["pending"], nil); err == nil {
+			e.registerConstMetricGauge(ch, "stream_consumer_pending", float64(pending), key, group, name)
+		}
+		if idle, err := redis.Int64(consumer["idle"], nil); err == nil {
+			e.registerConstMetricGauge(ch, "stream_consumer_idle_seconds", float64(idle)/1e3, key, group, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package exporter
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// testStreamBundle adds the replies of a stream queue:orders with one group and consumer to the test bundle
+func testStreamBundle(t *testing.T) *CaptureBundle {
+	b := testCaptureBundle(t)
+	reply := func(cmd []string, v interface{}) {
+		val, err := captureValue(v)
+		if err != nil {
+			t.Fatalf("captureValue() err: %s", err)
+		}
+		b.Replies = append(b.Replies, CapturedReply{Command: cmd, Reply: val})
+	}
+
+	lastDelivered := fmt.Sprintf("%d-0", time.Now().Add(-time.Minute).UnixMilli())
+	reply([]string{"SCAN", "0", "MATCH", "queue:*", "COUNT", "1000"}, []interface{}{[]byte("7"), []interface{}{[]byte("queue:orders")}})
+	reply([]string{"SCAN", "7", "MATCH", "queue:*", "COUNT", "1000"}, []interface{}{[]byte("0"), []interface{}{[]byte("queue:orders"), []byte("queue:lock")}})
+	reply([]string{"TYPE", "queue:orders"}, "stream")
+	reply([]string{"TYPE", "queue:lock"}, "string")
+	for _, key := range []string{"other", "a", "b", "c"} {
+		reply([]string{"TYPE", key}, "stream")
+	}
+	reply([]string{"XINFO", "STREAM", "queue:orders"}, []interface{}{
+		[]byte("length"), int64(42),
+		[]byte("groups"), int64(1),
+		[]byte("last-generated-id"), []byte("1700000000000-3"),
+	})
+	reply([]string{"XINFO", "STREAM", "queue:lock"}, redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value"))
+	reply([]string{"XINFO", "GROUPS", "queue:orders"}, []interface{}{[]interface{}{
+		[]byte("name"), []byte("workers"),
+		[]byte("consumers"), int64(1),
+		[]byte("pending"), int64(5),
+		[]byte("last-delivered-id"), []byte(lastDelivered),
+		[]byte("entries-read"), int64(30),
+		[]byte("lag"), int64(12),
+	}})
+	reply([]string{"XINFO", "CONSUMERS", "queue:orders", "workers"}, []interface{}{[]interface{}{
+		[]byte("name"), []byte("worker-1"),
+		[]byte("pending"), int64(5),
+		[]byte("idle"), int64(2500),
+	}})
+	return b
+}
+
+func TestStreamMetrics(t *testing.T) {
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test", CheckStreams: "queue:*", ReplayBundle: testStreamBundle(t), Registry: prometheus.NewRegistry()})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/metrics")
+	for _, want := range []string{
+		`test_stream_length{stream="queue:orders"} 42`,
+		`test_stream_groups{stream="queue:orders"} 1`,
+		`test_stream_last_generated_id_timestamp_seconds{stream="queue:orders"} 1.7e+09`,
+		`test_stream_group_consumers{group="workers",stream="queue:orders"} 1`,
+		`test_stream_group_pending{group="workers",stream="queue:orders"} 5`,
+		`test_stream_group_lag{group="workers",stream="queue:orders"} 12`,
+		`test_stream_group_last_delivered_id_age_seconds{group="workers",stream="queue:orders"} 6`,
+		`test_stream_consumer_pending{consumer="worker-1",group="workers",stream="queue:orders"} 5`,
+		`test_stream_consumer_idle_seconds{consumer="worker-1",group="workers",stream="queue:orders"} 2.5`,
+		`test_stream_keys_truncated 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `stream="queue:lock"`) {
+		t.Errorf("want keys that aren't streams to be skipped, have:\n%s", body)
+	}
+}
+
+func TestStreamKeys(t *testing.T) {
+	c := newReplayConn(testStreamBundle(t))
+
+	for _, tst := range []struct {
+		patterns  string
+		max       int
+		keys      []string
+		truncated bool
+	}{
+		{patterns: "queue:*", keys: []string{"queue:orders"}},
+		{patterns: "queue:*, queue:orders, other", keys: []string{"queue:orders", "other"}},
+		{patterns: "queue:lock, queue:*", max: 1, keys: []string{"queue:orders"}},
+		{patterns: "queue:*, other", max: 1, keys: []string{"queue:orders"}, truncated: true},
+		{patterns: "a,b,c", max: 2, keys: []string{"a", "b"}, truncated: true},
+	} {
+		e := &Exporter{options: Options{CheckStreams: tst.patterns, MaxStreamKeys: tst.max}}
+		keys, truncated := e.streamKeys(c)
+		if !reflect.DeepEqual(keys, tst.keys) || truncated != tst.truncated {
+			t.Errorf("streamKeys(%s) got: %v %v, want: %v %v", tst.patterns, keys, truncated, tst.keys, tst.truncated)
+		}
+	}
+}
+
+func TestStreamKeysScanCalls(t *testing.T) {
+	// SCAN never returns to cursor 0 and finds no streams
+	b := &CaptureBundle{Version: captureBundleVersion}
+	for i := 0; i <= maxScanCalls; i++ {
+		reply, _ := captureValue([]interface{}{[]byte(strconv.Itoa(i + 1)), []interface{}{}})
+		b.Replies = append(b.Replies, CapturedReply{Command: []string{"SCAN", strconv.Itoa(i), "MATCH", "queue:*", "COUNT", "1000"}, Reply: reply})
+	}
+	c := newReplayConn(b)
+
+	e := &Exporter{options: Options{CheckStreams: "queue:*"}}
+	keys, truncated := e.streamKeys(c)
+	// without the limit the walk ends at the first page missing from the bundle and isn't truncated
+	if len(keys) != 0 || !truncated {
+		t.Errorf("streamKeys() got: %v %v, want no keys and truncated", keys, truncated)
+	}
+}
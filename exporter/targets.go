@@ -0,0 +1,48 @@
+package exporter
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// targetLabel returns the value of the target label of addr, without the username and password
+func targetLabel(addr string) string {
+	if !strings.Contains(addr, "://") {
+		return addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return addr
+	}
+	u.User = nil
+	return u.String()
+}
+
+// collectTargets scrapes the exporters of Options.Targets, up to Options.TargetScrapeWorkers at a time.
+// Every target reports its own up, scrape error and duration series with its target label.
+func (e *Exporter) collectTargets(ch chan<- prometheus.Metric) {
+	workers := e.options.TargetScrapeWorkers
+	if workers <= 0 {
+		workers = 8
+	}
+
+	var wg sync.WaitGroup
+	queue := make(chan *Exporter)
+	for i := 0; i < workers && i < len(e.targets); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				t.collectKvrocks(ch)
+			}
+		}()
+	}
+	for _, t := range e.targets {
+		queue <- t
+	}
+	close(queue)
+	wg.Wait()
+}
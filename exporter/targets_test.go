@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTargets(t *testing.T) {
+	e, err := NewKvrocksExporter("", Options{
+		Namespace:           "test",
+		Targets:             []string{"localhost:6666", "redis://:secret@localhost:6667"},
+		TargetScrapeWorkers: 1,
+		ReplayBundle:        testCaptureBundle(t),
+		Registry:            prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatalf("NewKvrocksExporter() err: %s", err)
+	}
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/metrics")
+	for _, want := range []string{
+		`test_up{target="localhost:6666"} 1`,
+		`test_up{target="redis://localhost:6667"} 1`,
+		`test_exporter_last_scrape_error{err="",target="localhost:6666"} 0`,
+		`test_exporter_last_scrape_duration_seconds{target="redis://localhost:6667"}`,
+		`test_connected_clients{target="localhost:6666"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "secret") {
+		t.Errorf("want no passwords in the target labels, have:\n%s", body)
+	}
+}
+
+func TestTargetsDown(t *testing.T) {
+	e, _ := NewKvrocksExporter("", Options{
+		Namespace: "test",
+		Targets:   []string{"localhost:1", "localhost:2"},
+		Registry:  prometheus.NewRegistry(),
+	})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	body := downloadURL(t, ts.URL+"/metrics")
+	for _, want := range []string{`test_up{target="localhost:1"} 0`, `test_up{target="localhost:2"} 0`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want metrics to include %q, have:\n%s", want, body)
+		}
+	}
+
+	if _, err := NewKvrocksExporter("", Options{Targets: []string{"sentinel://localhost:26379"}}); err == nil {
+		t.Errorf("expected error for a sentinel target without master name")
+	}
+}
+
+func TestScrapeOnlyProbesTheTarget(t *testing.T) {
+	e, _ := NewKvrocksExporter("", Options{
+		Namespace: "test",
+		Targets:   []string{"redis://127.0.0.1:1", "redis://127.0.0.1:2"},
+		Registry:  prometheus.NewRegistry(),
+	})
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	for _, path := range []string{"/scrape?target=redis://127.0.0.1:3", "/scrape_cluster?seed=redis://127.0.0.1:3"} {
+		body := downloadURL(t, ts.URL+path)
+		if !strings.Contains(body, "test_up 0") {
+			t.Errorf("%s: want metrics to include test_up 0, have:\n%s", path, body)
+		}
+		if strings.Contains(body, `target="`) {
+			t.Errorf("%s: want only the series of the probed target, have:\n%s", path, body)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"targets": ["kvrocks://node-1:6666", "node-2:6666"]}`), 0o600); err != nil {
+		t.Fatalf("couldn't write config: %s", err)
+	}
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFile() err: %s", err)
+	}
+	if want := []string{"kvrocks://node-1:6666", "node-2:6666"}; !reflect.DeepEqual(cfg.Targets, want) {
+		t.Errorf("LoadConfigFile() targets got: %v, want: %v", cfg.Targets, want)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"target": ["node-1:6666"]}`), 0o600); err != nil {
+		t.Fatalf("couldn't write config: %s", err)
+	}
+	if _, err := LoadConfigFile(path); err == nil {
+		t.Errorf("expected error for an unknown field")
+	}
+	if _, err := LoadConfigFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+}
@@ -0,0 +1,60 @@
+package exporter
+
+import (
+	"github.com/RocksLabs/kvrocks_exporter/info"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RocksDB write stall counters of a column family by cause and kind
+var writeStallStats = map[string]struct{ cause, kind string }{
+	"level0_file_limit_slowdown":        {cause: "level0_file_limit", kind: "slowdown"},
+	"level0_file_limit_stop":            {cause: "level0_file_limit", kind: "stop"},
+	"pending_compaction_bytes_slowdown": {cause: "pending_compaction_bytes", kind: "slowdown"},
+	"pending_compaction_bytes_stop":     {cause: "pending_compaction_bytes", kind: "stop"},
+	"memtable_count_limit_slowdown":     {cause: "memtable_count_limit", kind: "slowdown"},
+	"memtable_count_limit_stop":         {cause: "memtable_count_limit", kind: "stop"},
+}
+
+// observeWriteStalls returns the write stall counters of the last scrape of the instance at addr, nil for the
+// first scrape, and remembers cur
+func (t *changeTracker) observeWriteStalls(addr string, cur map[string]float64) map[string]float64 {
+	t.Lock()
+	defer t.Unlock()
+
+	prev := t.writeStalls[addr]
+	t.writeStalls[addr] = cur
+	return prev
+}
+
+/*
+extractWriteStallMetrics exports the RocksDB write stall counters of all causes as one write_stalls_total family,
+and write_stalled as 1 for the counters that went up since the last scrape of the instance.
+*/
+func (e *Exporter) extractWriteStallMetrics(ch chan<- prometheus.Metric, snap *info.Snapshot) {
+	cur := map[string]float64{}
+	for cf, stats := range snap.ColumnFamilies {
+		for name, v := range stats {
+			if _, ok := writeStallStats[name]; ok {
+				cur[cf+"/"+name] = v
+			}
+		}
+	}
+	prev := e.changes.observeWriteStalls(targetLabel(e.kvrocksAddr), cur)
+
+	for cf, stats := range snap.ColumnFamilies {
+		for name, v := range stats {
+			stall, ok := writeStallStats[name]
+			if !ok {
+				continue
+			}
+			e.registerConstMetric(ch, "write_stalls_total", v, prometheus.CounterValue, stall.cause, stall.kind, cf)
+
+			stalled := 0.0
+			// the counters start from 0 again after a restart
+			if last, ok := prev[cf+"/"+name]; ok && v > last {
+				stalled = 1
+			}
+			e.registerConstMetricGauge(ch, "write_stalled", stalled, stall.cause, stall.kind, cf)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestWriteStallMetrics(t *testing.T) {
+	base := loadTestInfo(t)
+	stalled := strings.Replace(base, "pending_compaction_bytes_slowdown[default]:1", "pending_compaction_bytes_slowdown[default]:4", 1)
+
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test"})
+	for i, step := range []struct {
+		info    string
+		stalled float64
+	}{
+		{info: base},
+		{info: stalled, stalled: 1},
+		{info: stalled},
+		// after a restart
+		{info: base},
+	} {
+		mfs := gatherInfoMetrics(t, e, step.info)
+		if mf := mfs["test_write_stalls_total"]; mf == nil || mf.GetType() != dto.MetricType_COUNTER || len(mf.GetMetric()) != 36 {
+			t.Fatalf("step %d: want 36 write_stalls_total counters for 6 column families, got: %v", i, mf)
+		}
+
+		lbls := map[string]string{"cause": "level0_file_limit", "kind": "slowdown", "column_family": "default"}
+		if got, _ := metricValue(mfs, "test_write_stalls_total", lbls); got != 3 {
+			t.Errorf("step %d: write_stalls_total%v got: %v, want: 3", i, lbls, got)
+		}
+		if got, _ := metricValue(mfs, "test_write_stalled", lbls); got != 0 {
+			t.Errorf("step %d: write_stalled%v got: %v, want: 0", i, lbls, got)
+		}
+
+		lbls = map[string]string{"cause": "pending_compaction_bytes", "kind": "slowdown", "column_family": "default"}
+		if got, _ := metricValue(mfs, "test_write_stalled", lbls); got != step.stalled {
+			t.Errorf("step %d: write_stalled%v got: %v, want: %v", i, lbls, got, step.stalled)
+		}
+	}
+}
+
+func TestLegacyWriteStallMetrics(t *testing.T) {
+	e, _ := NewKvrocksExporter("localhost:6666", Options{Namespace: "test"})
+	mfs := gatherInfoMetrics(t, e, loadTestInfo(t))
+	for name := range writeStallStats {
+		if _, ok := mfs["test_"+name]; ok {
+			t.Errorf("deprecated metric %s shouldn't be exported by default", name)
+		}
+		if _, ok := mfs["test_rocksdb_"+name]; ok {
+			t.Errorf("write stall counter %s shouldn't be exported as an INFO field", name)
+		}
+	}
+
+	e, _ = NewKvrocksExporter("localhost:6666", Options{Namespace: "test", LegacyWriteStalls: true})
+	mfs = gatherInfoMetrics(t, e, loadTestInfo(t))
+	if got, _ := metricValue(mfs, "test_level0_file_limit_slowdown", map[string]string{"column_family": "default"}); got != 3 {
+		t.Errorf("level0_file_limit_slowdown got: %v, want: 3", got)
+	}
+	if mf := mfs["test_pending_compaction_bytes_stop"]; mf == nil || len(mf.GetMetric()) != 6 {
+		t.Errorf("want pending_compaction_bytes_stop for 6 column families, got: %v", mf)
+	}
+}
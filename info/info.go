@@ -0,0 +1,623 @@
+// Package info parses the reply of the Kvrocks INFO command into a typed snapshot.
+package info
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Snapshot holds the parsed reply of an INFO command.
+type Snapshot struct {
+	// Sections in the order of the reply
+	Sections []Section
+
+	Server      Server
+	Replication Replication
+	Keyspace    []Keyspace
+	// CommandStats in the order of the reply
+	CommandStats []*CommandStat
+	// ColumnFamilies holds the per column family RocksDB stats, by column family and stat name
+	ColumnFamilies map[string]map[string]float64
+
+	values map[string]string
+
+	// backing arrays that are reused by ParseInto
+	fields       []Field
+	stats        []CommandStat
+	histograms   []CommandHistogram
+	commandIndex map[string]int
+}
+
+// Section is a "# <Name>" block of the reply.
+type Section struct {
+	Name   string
+	Fields []Field
+}
+
+// Field is a "key:value" line of the reply.
+type Field struct {
+	Section string
+	Key     string
+	Value   string
+
+	// Name and ColumnFamily are set for RocksDB fields like `estimate_keys[default]`,
+	// Name is the same as Key for all other fields.
+	Name         string
+	ColumnFamily string
+}
+
+type Server struct {
+	Version         string
+	GitSHA1         string
+	OS              string
+	GCCVersion      string
+	TCPPort         string
+	ProcessID       string
+	UptimeInSeconds float64
+}
+
+type Replication struct {
+	Role             string
+	MasterHost       string
+	MasterPort       string
+	MasterLinkStatus string
+	SlaveReadOnly    string
+	Replicas         []Replica
+}
+
+type Replica struct {
+	Name   string
+	IP     string
+	Port   string
+	State  string
+	Offset float64
+	// Lag is -1 if not reported
+	Lag float64
+}
+
+type Keyspace struct {
+	DB      string
+	Keys    float64
+	Expires float64
+	// AvgTTL in seconds, -1 if not reported
+	AvgTTL  float64
+	Expired float64
+}
+
+type CommandStat struct {
+	Command string
+	Calls   float64
+	Usec    float64
+	// Histogram is nil unless Kvrocks reports a cmdstathist_<command> line
+	Histogram *CommandHistogram
+}
+
+// CommandHistogram holds the cumulative call counts per upper bound in seconds
+type CommandHistogram struct {
+	Count   uint64
+	Sum     uint64
+	Buckets map[float64]uint64
+}
+
+var linePrefixesToSkip = []string{
+	"# Last DBSIZE SCAN",
+	"# Last scan db time",
+	"# WARN:",
+}
+
+var errInvalidKeyValue = errors.New("invalid key=value pair")
+
+// Scan calls fn for every field of the reply of INFO or INFO ALL in a single pass. The fields
+// share memory with info, so scanning doesn't allocate. Lines that can't be parsed are skipped.
+func Scan(info string, fn func(f Field)) {
+	scan(info, nil, fn)
+}
+
+func scan(info string, onSection func(name string), onField func(f Field)) {
+	section := ""
+	for len(info) > 0 {
+		line := info
+		if idx := strings.IndexByte(info, '\n'); idx >= 0 {
+			line, info = info[:idx], info[idx+1:]
+		} else {
+			info = ""
+		}
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "# ") {
+			if skipLine(line) {
+				continue
+			}
+			section = line[2:]
+			if onSection != nil {
+				onSection(section)
+			}
+			continue
+		}
+
+		if len(line) < 2 {
+			continue
+		}
+		index := strings.LastIndexByte(line, ':')
+		if index < 0 {
+			continue
+		}
+
+		f := Field{Section: section, Key: line[:index], Value: line[index+1:]}
+		f.Name = f.Key
+		if idx := strings.IndexByte(f.Key, '['); idx > 0 && f.Key[len(f.Key)-1] == ']' {
+			f.Name = f.Key[:idx]
+			f.ColumnFamily = f.Key[idx+1 : len(f.Key)-1]
+		}
+		onField(f)
+	}
+}
+
+func skipLine(line string) bool {
+	for _, skipPrefix := range linePrefixesToSkip {
+		if strings.HasPrefix(line, skipPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse parses the reply of INFO or INFO ALL. Lines that can't be parsed are skipped.
+func Parse(info string) *Snapshot {
+	s := &Snapshot{}
+	s.parse(info)
+	return s
+}
+
+// ParseInto parses the reply of INFO or INFO ALL into s and reuses the memory held by s from an
+// earlier parse, which makes it cheap to parse replies over and over from a sync.Pool of snapshots.
+// Nothing returned by the earlier parse of s may be used afterwards, except for the histogram
+// buckets, which are always allocated anew.
+func ParseInto(s *Snapshot, info string) {
+	s.parse(info)
+}
+
+func (s *Snapshot) reset(lines, commands int) {
+	for i := range s.Sections {
+		s.Sections[i] = Section{}
+	}
+	s.Sections = s.Sections[:0]
+	if cap(s.fields) < lines {
+		s.fields = make([]Field, 0, lines)
+	}
+	s.fields = s.fields[:0]
+	if cap(s.stats) < commands {
+		s.stats = make([]CommandStat, 0, commands)
+	}
+	s.stats = s.stats[:0]
+	if cap(s.histograms) < commands {
+		s.histograms = make([]CommandHistogram, 0, commands)
+	}
+	s.histograms = s.histograms[:0]
+
+	s.Server = Server{}
+	s.Replication = Replication{Replicas: s.Replication.Replicas[:0]}
+	s.Keyspace = s.Keyspace[:0]
+	s.CommandStats = s.CommandStats[:0]
+
+	if s.values == nil {
+		s.values = make(map[string]string, lines)
+	}
+	clear(s.values)
+	if s.commandIndex == nil {
+		s.commandIndex = make(map[string]int, commands)
+	}
+	clear(s.commandIndex)
+	if s.ColumnFamilies == nil {
+		s.ColumnFamilies = map[string]map[string]float64{}
+	}
+	for _, stats := range s.ColumnFamilies {
+		clear(stats)
+	}
+}
+
+func (s *Snapshot) parse(info string) {
+	s.reset(strings.Count(info, "\n")+1, strings.Count(info, "cmdstat_"))
+
+	sectionStart := 0
+	endSection := func() {
+		if len(s.Sections) > 0 {
+			s.Sections[len(s.Sections)-1].Fields = s.fields[sectionStart:len(s.fields):len(s.fields)]
+		}
+		sectionStart = len(s.fields)
+	}
+
+	scan(info,
+		func(name string) {
+			endSection()
+			s.Sections = append(s.Sections, Section{Name: name})
+		},
+		func(f Field) {
+			if len(s.Sections) == 0 {
+				s.Sections = append(s.Sections, Section{})
+			}
+			s.fields = append(s.fields, f)
+			s.values[f.Key] = f.Value
+			s.parseField(f)
+		})
+	endSection()
+
+	// drop column families of an earlier parse that aren't reported anymore
+	for cf, stats := range s.ColumnFamilies {
+		if len(stats) == 0 {
+			delete(s.ColumnFamilies, cf)
+		}
+	}
+
+	s.Server = Server{
+		Version:    s.values["kvrocks_version"],
+		GitSHA1:    s.values["kvrocks_git_sha1"],
+		OS:         s.values["os"],
+		GCCVersion: s.values["gcc_version"],
+		TCPPort:    s.values["tcp_port"],
+		ProcessID:  s.values["process_id"],
+	}
+	s.Server.UptimeInSeconds, _ = strconv.ParseFloat(s.values["uptime_in_seconds"], 64)
+
+	s.Replication.Role = s.values["role"]
+	s.Replication.MasterHost = s.values["master_host"]
+	s.Replication.MasterPort = s.values["master_port"]
+	s.Replication.MasterLinkStatus = s.values["master_link_status"]
+	s.Replication.SlaveReadOnly = s.values["slave_read_only"]
+}
+
+func (s *Snapshot) parseField(f Field) {
+	switch f.Section {
+	case "Replication":
+		if r, ok := ParseReplica(f.Key, f.Value); ok {
+			s.Replication.Replicas = append(s.Replication.Replicas, r)
+		}
+
+	case "Keyspace":
+		if ks, ok := ParseKeyspace(f.Key, f.Value); ok {
+			s.Keyspace = append(s.Keyspace, ks)
+		}
+
+	case "Commandstats", "CommandStats":
+		if strings.HasPrefix(f.Key, "cmdstathist_") {
+			if cmd, count, sum, buckets, err := ParseCommandStatHist(f.Key, f.Value); err == nil {
+				stat := s.commandStat(cmd)
+				stat.Histogram = s.commandHistogram()
+				*stat.Histogram = CommandHistogram{Count: count, Sum: sum, Buckets: buckets}
+				if stat.Calls == 0 && stat.Usec == 0 {
+					stat.Calls = float64(count)
+					stat.Usec = float64(sum)
+				}
+			}
+			return
+		}
+		if cmd, calls, usec, err := ParseCommandStat(f.Key, f.Value); err == nil {
+			stat := s.commandStat(cmd)
+			stat.Calls = calls
+			stat.Usec = usec
+		}
+
+	case "RocksDB":
+		if f.ColumnFamily == "" {
+			return
+		}
+		if val, err := strconv.ParseFloat(f.Value, 64); err == nil {
+			stats := s.ColumnFamilies[f.ColumnFamily]
+			if stats == nil {
+				stats = map[string]float64{}
+				s.ColumnFamilies[f.ColumnFamily] = stats
+			}
+			stats[f.Name] = val
+		}
+	}
+}
+
+func (s *Snapshot) commandStat(cmd string) *CommandStat {
+	if idx, ok := s.commandIndex[cmd]; ok {
+		return s.CommandStats[idx]
+	}
+
+	var stat *CommandStat
+	if len(s.stats) < cap(s.stats) {
+		// appending within the capacity keeps the pointers handed out before valid
+		s.stats = append(s.stats, CommandStat{Command: cmd})
+		stat = &s.stats[len(s.stats)-1]
+	} else {
+		stat = &CommandStat{Command: cmd}
+	}
+	s.commandIndex[cmd] = len(s.CommandStats)
+	s.CommandStats = append(s.CommandStats, stat)
+	return stat
+}
+
+func (s *Snapshot) commandHistogram() *CommandHistogram {
+	if len(s.histograms) < cap(s.histograms) {
+		s.histograms = append(s.histograms, CommandHistogram{})
+		return &s.histograms[len(s.histograms)-1]
+	}
+	return &CommandHistogram{}
+}
+
+// Value returns the value of a field, if a key is reported more than once the last value wins.
+func (s *Snapshot) Value(key string) string {
+	return s.values[key]
+}
+
+// Lookup returns the value of a field and whether it was reported.
+func (s *Snapshot) Lookup(key string) (string, bool) {
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// Section returns the section with the given name or nil.
+func (s *Snapshot) Section(name string) *Section {
+	for i := range s.Sections {
+		if s.Sections[i].Name == name {
+			return &s.Sections[i]
+		}
+	}
+	return nil
+}
+
+// nextPair cuts the next "key=value" pair off a list of pairs separated by sep
+func nextPair(list string, sep byte) (key, value, rest string, ok bool) {
+	pair := list
+	if idx := strings.IndexByte(list, sep); idx >= 0 {
+		pair, rest = list[:idx], list[idx+1:]
+	}
+	key, value, ok = strings.Cut(pair, "=")
+	if ok && strings.IndexByte(value, '=') >= 0 {
+		ok = false
+	}
+	return
+}
+
+func extractVal(s string) (val float64, err error) {
+	_, v, ok := strings.Cut(s, "=")
+	if !ok || strings.IndexByte(v, '=') >= 0 {
+		return 0, errInvalidKeyValue
+	}
+	val, err = strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, errInvalidKeyValue
+	}
+	return
+}
+
+/*
+ParseKeyspace parses a line of the Keyspace section.
+
+valid examples:
+  - db0:keys=1,expires=0,avg_ttl=0
+  - db0:keys=1,expires=10,avg_ttl=0,expired=2
+*/
+func ParseKeyspace(inputKey string, inputVal string) (ks Keyspace, ok bool) {
+	if !strings.HasPrefix(inputKey, "db") {
+		log.Debugf("ParseKeyspace inputKey not starting with 'db': [%s]", inputKey)
+		return
+	}
+
+	var vals [4]float64
+	n := strings.Count(inputVal, ",") + 1
+	if n < 2 || n > len(vals) {
+		log.Debugf("ParseKeyspace inputVal invalid: [%s]", inputVal)
+		return
+	}
+
+	rest := inputVal
+	for i := 0; i < n; i++ {
+		part := rest
+		if idx := strings.IndexByte(rest, ','); idx >= 0 {
+			part, rest = rest[:idx], rest[idx+1:]
+		}
+		val, err := extractVal(part)
+		if err != nil {
+			log.Debugf("ParseKeyspace extractVal(%s) invalid, err: %s", part, err)
+			return Keyspace{}, false
+		}
+		vals[i] = val
+	}
+
+	ks.DB = inputKey
+	ks.Keys = vals[0]
+	ks.Expires = vals[1]
+	ks.AvgTTL = -1
+	if n > 2 {
+		ks.AvgTTL = vals[2] / 1000
+	}
+	ks.Expired = vals[3]
+
+	ok = true
+	return
+}
+
+// isReplicaName matches `^slave\d+`
+func isReplicaName(s string) bool {
+	return len(s) > len("slave") && strings.HasPrefix(s, "slave") && s[5] >= '0' && s[5] <= '9'
+}
+
+/*
+ParseReplica parses a replica line of the Replication section.
+
+valid examples:
+  - slave0:ip=10.254.11.1,port=6379,state=online,offset=1751844676,lag=0
+  - slave1:ip=10.254.11.2,port=6379,state=online,offset=1751844222,lag=0
+*/
+func ParseReplica(slaveName string, keyValues string) (r Replica, ok bool) {
+	if !isReplicaName(slaveName) {
+		return
+	}
+
+	var offsetStr, lagStr string
+	hasLag := false
+	for rest := keyValues; ; {
+		var k, v string
+		var valid bool
+		k, v, rest, valid = nextPair(rest, ',')
+		if !valid {
+			log.Debugf("Invalid format for connected slave string, got: %s", keyValues)
+			return Replica{}, false
+		}
+		switch k {
+		case "ip":
+			r.IP = v
+		case "port":
+			r.Port = v
+		case "state":
+			r.State = v
+		case "offset":
+			offsetStr = v
+		case "lag":
+			lagStr, hasLag = v, true
+		}
+		if rest == "" {
+			break
+		}
+	}
+
+	var err error
+	if r.Offset, err = strconv.ParseFloat(offsetStr, 64); err != nil {
+		log.Debugf("Can not parse connected slave offset, got: %s", offsetStr)
+		return Replica{}, false
+	}
+
+	r.Lag = -1
+	if hasLag {
+		if r.Lag, err = strconv.ParseFloat(lagStr, 64); err != nil {
+			log.Debugf("Can not parse connected slave lag, got: %s", lagStr)
+			return Replica{}, false
+		}
+	}
+
+	r.Name = slaveName
+	return r, true
+}
+
+/*
+ParseCommandStat parses a cmdstat_ line of the Commandstats section.
+
+Format:
+
+	cmdstat_get:calls=21,usec=175,usec_per_call=8.33
+	cmdstat_set:calls=61,usec=3139,usec_per_call=51.46
+	cmdstat_setex:calls=75,usec=1260,usec_per_call=16.80
+	cmdstat_georadius_ro:calls=75,usec=1260,usec_per_call=16.80
+
+broken up like this:
+
+	fieldKey  = cmdstat_get
+	fieldValue= calls=21,usec=175,usec_per_call=8.33
+*/
+func ParseCommandStat(fieldKey string, fieldValue string) (string, float64, float64, error) {
+	const cmdPrefix = "cmdstat_"
+
+	if !strings.HasPrefix(fieldKey, cmdPrefix) {
+		return "", 0.0, 0.0, errors.New("Invalid fieldKey")
+	}
+	cmd := strings.TrimPrefix(fieldKey, cmdPrefix)
+
+	callsPart, rest, _ := strings.Cut(fieldValue, ",")
+	usecPart, _, found := strings.Cut(rest, ",")
+	if !found {
+		return "", 0.0, 0.0, errors.New("Invalid fieldValue")
+	}
+
+	calls, err := extractVal(callsPart)
+	if err != nil {
+		return "", 0.0, 0.0, errors.New("Invalid splitValue[0]")
+	}
+
+	usecTotal, err := extractVal(usecPart)
+	if err != nil {
+		return "", 0.0, 0.0, errors.New("Invalid splitValue[1]")
+	}
+
+	return cmd, calls, usecTotal, nil
+}
+
+type histBucket struct {
+	upperBound float64
+	count      uint64
+}
+
+/*
+ParseCommandStatHist parses a cmdstathist_ line of the Commandstats section,
+the returned buckets are cumulative and their upper bounds are in seconds.
+
+Format:
+
+	cmdstathist_get:10=1191,20=1,50=0,70=0,100=0,150=0,inf=0,sum=12388,count=1192
+
+broken up like this:
+
+	fieldKey = cmdstathist_get
+	fieldValue = 10=1191,20=1,50=0,70=0,100=0,150=0,inf=0,sum=12388,count=1192
+*/
+func ParseCommandStatHist(fieldKey string, fieldValue string) (string, uint64, uint64, map[float64]uint64, error) {
+	const cmdPrefix = "cmdstathist_"
+
+	if !strings.HasPrefix(fieldKey, cmdPrefix) {
+		return "", 0, 0, nil, errors.New("invalid fieldKey")
+	}
+	cmd := strings.TrimPrefix(fieldKey, cmdPrefix)
+
+	// Kvrocks reports 7 buckets, so they fit on the stack
+	var buf [16]histBucket
+	buckets := buf[:0]
+
+	var sum, count uint64
+	var err error
+	for rest := fieldValue; rest != ""; {
+		var key, value string
+		var ok bool
+		key, value, rest, ok = nextPair(rest, ',')
+		if !ok {
+			return "", 0, 0, nil, errors.New("uneven number of keys for bucket")
+		}
+
+		switch key {
+		case "sum":
+			sum, err = strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return "", 0, 0, nil, fmt.Errorf("invalid value for sum: %w", err)
+			}
+			continue
+		case "count":
+			count, err = strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return "", 0, 0, nil, fmt.Errorf("invalid value for count: %w", err)
+			}
+			continue
+		}
+
+		bucketCount, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return "", 0, 0, nil, fmt.Errorf("invalid splitValue for bucket: %w", err)
+		}
+		bucketValue := math.Inf(1)
+		if val, err := strconv.ParseFloat(strings.TrimSpace(key), 64); err == nil {
+			bucketValue = val / 1e6
+		}
+
+		// insertion sort, the buckets are usually reported in order already
+		i := len(buckets)
+		buckets = append(buckets, histBucket{})
+		for ; i > 0 && buckets[i-1].upperBound > bucketValue; i-- {
+			buckets[i] = buckets[i-1]
+		}
+		buckets[i] = histBucket{upperBound: bucketValue, count: bucketCount}
+	}
+
+	histogram := make(map[float64]uint64, len(buckets))
+	var cumulative uint64
+	for _, b := range buckets {
+		cumulative += b.count
+		histogram[b.upperBound] = cumulative
+	}
+	return cmd, count, sum, histogram, nil
+}
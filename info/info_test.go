@@ -0,0 +1,484 @@
+package info
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	b, err := os.ReadFile("../exporter/testdata/info-all.txt")
+	if err != nil {
+		t.Fatalf("couldn't load INFO fixture, err: %s", err)
+	}
+	s := Parse(string(b))
+
+	var sections []string
+	for _, sec := range s.Sections {
+		sections = append(sections, sec.Name)
+	}
+	wantSections := []string{"Server", "Clients", "Memory", "Persistence", "Stats", "Replication", "CPU", "Commandstats", "Keyspace", "RocksDB"}
+	if !reflect.DeepEqual(sections, wantSections) {
+		t.Errorf("got sections: %v, wanted: %v", sections, wantSections)
+	}
+
+	if s.Server.Version != "2.10.1" || s.Server.TCPPort != "6666" || s.Server.ProcessID != "2041" || s.Server.UptimeInSeconds != 86412 {
+		t.Errorf("unexpected server fields: %#v", s.Server)
+	}
+	if s.Value("connected_clients") != "42" {
+		t.Errorf("unexpected connected_clients: %s", s.Value("connected_clients"))
+	}
+	if _, ok := s.Lookup("master_host"); ok {
+		t.Errorf("didn't expect master_host on a master")
+	}
+	if sec := s.Section("Clients"); sec == nil || len(sec.Fields) != 4 || sec.Fields[1].Key != "connected_clients" {
+		t.Errorf("unexpected Clients section: %#v", sec)
+	}
+
+	wantKeyspace := []Keyspace{{DB: "db0", Keys: 1827364, Expires: 182736, AvgTTL: 3600, Expired: 18273}}
+	if !reflect.DeepEqual(s.Keyspace, wantKeyspace) {
+		t.Errorf("got keyspace: %#v, wanted: %#v", s.Keyspace, wantKeyspace)
+	}
+
+	if s.Replication.Role != "master" || len(s.Replication.Replicas) != 2 {
+		t.Fatalf("unexpected replication: %#v", s.Replication)
+	}
+	if r := s.Replication.Replicas[1]; r.Name != "slave1" || r.IP != "10.0.0.13" || r.Offset != 918273600 || r.Lag != 1 {
+		t.Errorf("unexpected replica: %#v", r)
+	}
+
+	if len(s.CommandStats) != 10 {
+		t.Fatalf("expected 10 command stats, got %d", len(s.CommandStats))
+	}
+	for _, stat := range s.CommandStats {
+		switch stat.Command {
+		case "get":
+			if stat.Calls != 61827364 || stat.Histogram == nil || stat.Histogram.Count != 61827364 || stat.Histogram.Buckets[math.Inf(1)] != 61827364 {
+				t.Errorf("unexpected get stats: %#v %#v", stat, stat.Histogram)
+			}
+		case "del":
+			if stat.Calls != 182736 || stat.Usec != 2740000 || stat.Histogram != nil {
+				t.Errorf("unexpected del stats: %#v", stat)
+			}
+		}
+	}
+
+	if len(s.ColumnFamilies) != 6 {
+		t.Errorf("expected 6 column families, got: %v", s.ColumnFamilies)
+	}
+	if v := s.ColumnFamilies["default"]["estimate_keys"]; v != 18273640 {
+		t.Errorf("unexpected estimate_keys[default]: %f", v)
+	}
+	if v := s.ColumnFamilies["metadata"]["level0_file_limit_slowdown"]; v != 1 {
+		t.Errorf("unexpected level0_file_limit_slowdown[metadata]: %f", v)
+	}
+}
+
+func TestParseReplicaRole(t *testing.T) {
+	s := Parse("# Replication\r\nrole:slave\r\nmaster_host:10.0.0.1\r\nmaster_port:6666\r\nmaster_link_status:up\r\nslave_read_only:1\r\n")
+	want := Replication{Role: "slave", MasterHost: "10.0.0.1", MasterPort: "6666", MasterLinkStatus: "up", SlaveReadOnly: "1"}
+	if !reflect.DeepEqual(s.Replication, want) {
+		t.Errorf("got: %#v, wanted: %#v", s.Replication, want)
+	}
+}
+
+func TestParseKeyspace(t *testing.T) {
+	tsts := []struct {
+		db                                     string
+		stats                                  string
+		keysTotal, keysEx, avgTTL, keysExpired float64
+		ok                                     bool
+	}{
+		{db: "xxx", stats: "", ok: false},
+		{db: "xxx", stats: "keys=1,expires=0,avg_ttl=0", ok: false},
+		{db: "db0", stats: "xxx", ok: false},
+		{db: "db1", stats: "keys=abcd,expires=0,avg_ttl=0", ok: false},
+		{db: "db2", stats: "keys=1234=1234,expires=0,avg_ttl=0", ok: false},
+
+		{db: "db3", stats: "keys=abcde,expires=0", ok: false},
+		{db: "db3", stats: "keys=213,expires=xxx", ok: false},
+		{db: "db3", stats: "keys=123,expires=0,avg_ttl=zzz", ok: false},
+		{db: "db0", stats: "keys=22113592,expires=21683101,avg_ttl=3816396,expired=340250", keysTotal: 22113592, keysEx: 21683101, avgTTL: 3816.396, keysExpired: 340250, ok: true},
+		{db: "db0", stats: "keys=1,expires=0,avg_ttl=0", keysTotal: 1, keysEx: 0, avgTTL: 0, keysExpired: 0, ok: true},
+	}
+
+	for _, tst := range tsts {
+		if ks, ok := ParseKeyspace(tst.db, tst.stats); true {
+			kt, kx, ttl, kexp := ks.Keys, ks.Expires, ks.AvgTTL, ks.Expired
+
+			if ok != tst.ok {
+				t.Errorf("failed for: db:%s stats:%s", tst.db, tst.stats)
+				continue
+			}
+
+			if ok && (kt != tst.keysTotal || kx != tst.keysEx || ttl != tst.avgTTL || kexp != tst.keysExpired) {
+				t.Errorf("values not matching, db:%s stats:%s   %f %f %f %f", tst.db, tst.stats, kt, kx, ttl, kexp)
+			}
+		}
+	}
+}
+
+type slaveData struct {
+	k, v            string
+	ip, state, port string
+	offset          float64
+	lag             float64
+	ok              bool
+}
+
+func TestParseReplica(t *testing.T) {
+	tsts := []slaveData{
+		{k: "slave0", v: "ip=10.254.11.1,port=6379,state=online,offset=1751844676,lag=0", offset: 1751844676, ip: "10.254.11.1", port: "6379", state: "online", ok: true, lag: 0},
+		{k: "slave0", v: "ip=2a00:1450:400e:808::200e,port=6379,state=online,offset=1751844676,lag=0", offset: 1751844676, ip: "2a00:1450:400e:808::200e", port: "6379", state: "online", ok: true, lag: 0},
+		{k: "slave1", v: "offset=1,lag=0", offset: 1, ok: true},
+		{k: "slave1", v: "offset=1", offset: 1, ok: true, lag: -1},
+		{k: "slave2", v: "ip=1.2.3.4,state=online,offset=123,lag=42", offset: 123, ip: "1.2.3.4", state: "online", ok: true, lag: 42},
+
+		{k: "slave", v: "offset=1751844676,lag=0", ok: false},
+		{k: "slaveA", v: "offset=1751844676,lag=0", ok: false},
+		{k: "slave0", v: "offset=abc,lag=0", ok: false},
+		{k: "slave0", v: "offset=0,lag=abc", ok: false},
+	}
+
+	for _, tst := range tsts {
+		t.Run(fmt.Sprintf("%s---%s", tst.k, tst.v), func(t *testing.T) {
+			r, ok := ParseReplica(tst.k, tst.v)
+			offset, ip, port, state, lag := r.Offset, r.IP, r.Port, r.State, r.Lag
+
+			if ok != tst.ok {
+				t.Errorf("failed for: db:%s stats:%s", tst.k, tst.v)
+				return
+			}
+			if offset != tst.offset || ip != tst.ip || port != tst.port || state != tst.state || lag != tst.lag {
+				t.Errorf("values not matching, string:%s %f %s %s %s %f", tst.v, offset, ip, port, state, lag)
+			}
+		})
+	}
+}
+
+func TestParseCommandStat(t *testing.T) {
+
+	for _, tst := range []struct {
+		fieldKey   string
+		fieldValue string
+
+		wantSuccess   bool
+		wantCmd       string
+		wantCalls     float64
+		wantUsecTotal float64
+	}{
+		{
+			fieldKey:      "cmdstat_get",
+			fieldValue:    "calls=21,usec=175,usec_per_call=8.33",
+			wantSuccess:   true,
+			wantCmd:       "get",
+			wantCalls:     21,
+			wantUsecTotal: 175,
+		},
+		{
+			fieldKey:      "cmdstat_georadius_ro",
+			fieldValue:    "calls=75,usec=1260,usec_per_call=16.80",
+			wantSuccess:   true,
+			wantCmd:       "georadius_ro",
+			wantCalls:     75,
+			wantUsecTotal: 1260,
+		},
+		{
+			fieldKey:    "borked_stats",
+			fieldValue:  "calls=75,usec=1260,usec_per_call=16.80",
+			wantSuccess: false,
+		},
+		{
+			fieldKey:    "cmdstat_georadius_ro",
+			fieldValue:  "borked_values",
+			wantSuccess: false,
+		},
+
+		{
+			fieldKey:    "cmdstat_georadius_ro",
+			fieldValue:  "usec_per_call=16.80",
+			wantSuccess: false,
+		},
+		{
+			fieldKey:    "cmdstat_georadius_ro",
+			fieldValue:  "calls=ABC,usec=1260,usec_per_call=16.80",
+			wantSuccess: false,
+		},
+		{
+			fieldKey:    "cmdstat_georadius_ro",
+			fieldValue:  "calls=75,usec=DEF,usec_per_call=16.80",
+			wantSuccess: false,
+		},
+		{
+			fieldKey:    "cmdstat_georadius_ro",
+			fieldValue:  "calls=75,usec=DEF,usec_per_call=16.80",
+			wantSuccess: false,
+		},
+	} {
+		t.Run(tst.fieldKey+tst.fieldValue, func(t *testing.T) {
+
+			cmd, calls, usecTotal, err := ParseCommandStat(tst.fieldKey, tst.fieldValue)
+
+			if tst.wantSuccess && err != nil {
+				t.Fatalf("err: %s", err)
+				return
+			}
+
+			if !tst.wantSuccess && err == nil {
+				t.Fatalf("expected err!")
+				return
+			}
+
+			if !tst.wantSuccess {
+				return
+			}
+
+			if cmd != tst.wantCmd {
+				t.Fatalf("cmd not matching, got: %s, wanted: %s", cmd, tst.wantCmd)
+			}
+
+			if calls != tst.wantCalls {
+				t.Fatalf("cmd not matching, got: %f, wanted: %f", calls, tst.wantCalls)
+			}
+			if usecTotal != tst.wantUsecTotal {
+				t.Fatalf("cmd not matching, got: %f, wanted: %f", usecTotal, tst.wantUsecTotal)
+			}
+		})
+	}
+}
+
+func TestParseCommandStatHist(t *testing.T) {
+
+	for _, tst := range []struct {
+		fieldKey   string
+		fieldValue string
+
+		wantSuccess bool
+		wantCmd     string
+		wantBuckets map[float64]uint64
+		wantSum     uint64
+		wantCount   uint64
+	}{
+		{
+			fieldKey:    "cmdstathist_get",
+			fieldValue:  "10=1191,20=1,50=0,70=0,100=0,150=0,inf=0,sum=10000,count=1192",
+			wantSuccess: true,
+			wantCmd:     "get",
+			wantBuckets: map[float64]uint64{
+				0.00001:     1191,
+				0.00002:     1192,
+				0.00005:     1192,
+				0.00007:     1192,
+				0.0001:      1192,
+				0.00015:     1192,
+				math.Inf(1): 1192,
+			},
+			wantSum:   10000,
+			wantCount: 1192,
+		},
+		{
+			fieldKey:    "cmdstathist_hget",
+			fieldValue:  "",
+			wantSuccess: true,
+			wantCmd:     "hget",
+			wantBuckets: map[float64]uint64{},
+		},
+		{
+			fieldKey:    "cmdstathis_hget",
+			fieldValue:  "fd",
+			wantSuccess: false,
+			wantCmd:     "hget",
+		},
+		{
+			fieldKey:    "cmdstathist_hget",
+			fieldValue:  "fd",
+			wantSuccess: false,
+			wantCmd:     "hget",
+		},
+		{
+			fieldKey:    "cmdstathist_hget",
+			fieldValue:  "fd=malformed",
+			wantSuccess: false,
+			wantCmd:     "hget",
+		},
+		{
+			fieldKey:    "cmdstathist_get",
+			fieldValue:  "10=1191,20=1,50=0,70=0,100=0,150=0,inf=0,sum=,count=1192",
+			wantSuccess: false,
+			wantCmd:     "get",
+			wantBuckets: map[float64]uint64{
+				0.00001:     1191,
+				0.00002:     1192,
+				0.00005:     1192,
+				0.00007:     1192,
+				0.0001:      1192,
+				0.00015:     1192,
+				math.Inf(1): 1192,
+			},
+			wantSum:   0,
+			wantCount: 1192,
+		},
+		{
+			fieldKey:    "cmdstathist_get",
+			fieldValue:  "10=1191,20=1,50=0,70=0,100=0,150=0,inf=0,sum=aa,count=1192",
+			wantSuccess: false,
+			wantCmd:     "get",
+			wantBuckets: map[float64]uint64{
+				0.00001:     1191,
+				0.00002:     1192,
+				0.00005:     1192,
+				0.00007:     1192,
+				0.0001:      1192,
+				0.00015:     1192,
+				math.Inf(1): 1192,
+			},
+			wantSum:   0,
+			wantCount: 1192,
+		},
+		{
+			fieldKey:    "cmdstathist_get",
+			fieldValue:  "10=1191,20=1,50=0,70=0,100=0,150=0,inf=0,sum=10000,count=",
+			wantSuccess: false,
+			wantCmd:     "get",
+			wantBuckets: map[float64]uint64{
+				0.00001:     1191,
+				0.00002:     1192,
+				0.00005:     1192,
+				0.00007:     1192,
+				0.0001:      1192,
+				0.00015:     1192,
+				math.Inf(1): 1192,
+			},
+			wantSum:   10000,
+			wantCount: 0,
+		},
+		{
+			fieldKey:    "cmdstathist_get",
+			fieldValue:  "10=1191,20=1,50=0,70=0,100=0,150=0,inf=0,sum=10000,count=dasd",
+			wantSuccess: false,
+			wantCmd:     "get",
+			wantBuckets: map[float64]uint64{
+				0.00001:     1191,
+				0.00002:     1192,
+				0.00005:     1192,
+				0.00007:     1192,
+				0.0001:      1192,
+				0.00015:     1192,
+				math.Inf(1): 1192,
+			},
+			wantSum:   10000,
+			wantCount: 0,
+		},
+	} {
+		t.Run(tst.fieldKey+tst.fieldValue, func(t *testing.T) {
+			cmd, count, sum, buckets, err := ParseCommandStatHist(tst.fieldKey, tst.fieldValue)
+
+			if tst.wantSuccess && err != nil {
+				t.Fatalf("err: %s", err)
+				return
+			}
+
+			if !tst.wantSuccess && err == nil {
+				t.Fatalf("expected err!")
+				return
+			}
+
+			if !tst.wantSuccess {
+				return
+			}
+
+			if cmd != tst.wantCmd {
+				t.Fatalf("cmd not matching, got: %s, wanted: %s", cmd, tst.wantCmd)
+			}
+
+			if !reflect.DeepEqual(buckets, tst.wantBuckets) {
+				t.Fatalf("cmd not matching, got: %v, wanted: %v", buckets, tst.wantBuckets)
+			}
+
+			if count != tst.wantCount {
+				t.Fatalf("count not matching, got: %d, wanted: %d", count, tst.wantCount)
+			}
+
+			if sum != tst.wantSum {
+				t.Fatalf("count not matching, got: %d, wanted: %d", sum, tst.wantSum)
+			}
+		})
+	}
+
+}
+
+func loadBenchInfo(b *testing.B) string {
+	buf, err := os.ReadFile("../exporter/testdata/info-all-large.txt")
+	if err != nil {
+		b.Fatalf("couldn't read testdata: %s", err)
+	}
+	return string(buf)
+}
+
+func BenchmarkParse(b *testing.B) {
+	reply := loadBenchInfo(b)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(reply)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Parse(reply)
+	}
+}
+
+func BenchmarkParseInto(b *testing.B) {
+	reply := loadBenchInfo(b)
+	s := &Snapshot{}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(reply)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ParseInto(s, reply)
+	}
+}
+
+func TestParseInto(t *testing.T) {
+	large, err := os.ReadFile("../exporter/testdata/info-all-large.txt")
+	if err != nil {
+		t.Fatalf("couldn't load INFO fixture, err: %s", err)
+	}
+	small, err := os.ReadFile("../exporter/testdata/info-all.txt")
+	if err != nil {
+		t.Fatalf("couldn't load INFO fixture, err: %s", err)
+	}
+
+	s := &Snapshot{}
+	for _, reply := range []string{string(large), string(small), string(large)} {
+		ParseInto(s, reply)
+		want := Parse(reply)
+
+		if !reflect.DeepEqual(s.Sections, want.Sections) {
+			t.Errorf("sections differ from Parse()")
+		}
+		if !reflect.DeepEqual(s.Server, want.Server) || !reflect.DeepEqual(s.Replication, want.Replication) {
+			t.Errorf("server or replication differ from Parse(), got: %+v %+v", s.Server, s.Replication)
+		}
+		if !reflect.DeepEqual(s.Keyspace, want.Keyspace) || !reflect.DeepEqual(s.CommandStats, want.CommandStats) {
+			t.Errorf("keyspace or command stats differ from Parse()")
+		}
+		if !reflect.DeepEqual(s.ColumnFamilies, want.ColumnFamilies) {
+			t.Errorf("column families differ from Parse(), got: %v, want: %v", s.ColumnFamilies, want.ColumnFamilies)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	var got []Field
+	Scan("# Server\r\nkvrocks_version:2.10.1\r\n# Last scan db time: Thu Jan 1\r\nno colon\r\n# RocksDB\r\nestimate_keys[default]:42", func(f Field) {
+		got = append(got, f)
+	})
+
+	want := []Field{
+		{Section: "Server", Key: "kvrocks_version", Value: "2.10.1", Name: "kvrocks_version"},
+		{Section: "RocksDB", Key: "estimate_keys[default]", Value: "42", Name: "estimate_keys", ColumnFamily: "default"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Scan() got: %+v, want: %+v", got, want)
+	}
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"net/http"
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/RocksLabs/kvrocks_exporter/exporter"
@@ -40,9 +42,51 @@ func getEnvBool(key string, defaultVal bool) bool {
 	return defaultVal
 }
 
+func getEnvInt(key string, defaultVal int) int {
+	if envVal, ok := os.LookupEnv(key); ok {
+		envInt, err := strconv.Atoi(envVal)
+		if err == nil {
+			return envInt
+		}
+	}
+	return defaultVal
+}
+
+// splitAddrs splits the comma separated addresses of --kvrocks.addr
+func splitAddrs(s string) []string {
+	var res []string
+	for _, addr := range strings.Split(s, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			res = append(res, addr)
+		}
+	}
+	return res
+}
+
+// isAddrSet returns whether --kvrocks.addr was set explicitly, by flag or environment variable
+func isAddrSet() bool {
+	if _, ok := os.LookupEnv("KVROCKS_ADDR"); ok {
+		return true
+	}
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "kvrocks.addr" {
+			set = true
+		}
+	})
+	return set
+}
+
 func main() {
+	// the first argument can be a command, e.g. `kvrocks_exporter capture --kvrocks.addr=...`
+	command := ""
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	var (
-		redisAddr           = flag.String("kvrocks.addr", getEnv("KVROCKS_ADDR", "kvrocks://localhost:6666"), "Address of the Kvrocks instance to scrape")
+		redisAddr           = flag.String("kvrocks.addr", getEnv("KVROCKS_ADDR", "kvrocks://localhost:6666"), "Address of the Kvrocks instance to scrape, or a comma separated list of addresses to scrape all of them on /metrics")
 		kvrocksPwd          = flag.String("kvrocks.password", getEnv("KVROCKS_PASSWORD", ""), "Password of the Kvrocks instance to scrape")
 		kvrocksPwdFile      = flag.String("kvrocks.password-file", getEnv("KVROCKS_PASSWORD_FILE", ""), "Password file of the Kvrocks instance to scrape")
 		namespace           = flag.String("namespace", getEnv("KVROCKS_EXPORTER_NAMESPACE", "kvrocks"), "Namespace for metrics")
@@ -64,9 +108,76 @@ func main() {
 		pingOnConnect       = flag.Bool("ping-on-connect", getEnvBool("KVROCKS_EXPORTER_PING_ON_CONNECT", false), "Whether to ping the Kvrocks instance after connecting")
 		inclSystemMetrics   = flag.Bool("include-system-metrics", getEnvBool("KVROCKS_EXPORTER_INCL_SYSTEM_METRICS", false), "Whether to include system metrics like e.g. kvrocks_total_system_memory_bytes")
 		skipTLSVerification = flag.Bool("skip-tls-verification", getEnvBool("KVROCKS_EXPORTER_SKIP_TLS_VERIFICATION", false), "Whether to to skip TLS verification")
+		controllerAddr      = flag.String("controller.addr", getEnv("KVROCKS_EXPORTER_CONTROLLER_ADDR", ""), "Address of a kvrocks-controller to export cluster, shard and migration metrics from")
+		exportAllInfoFields = flag.Bool("export-all-info-fields", getEnvBool("KVROCKS_EXPORTER_EXPORT_ALL_INFO_FIELDS", false), "Whether to export every numeric INFO field without a dedicated metric as <section>_<field>")
+		infoFieldsInclude   = flag.String("info-fields-include", getEnv("KVROCKS_EXPORTER_INFO_FIELDS_INCLUDE", ""), "Regex of the <section>_<field> names to export with --export-all-info-fields")
+		infoFieldsExclude   = flag.String("info-fields-exclude", getEnv("KVROCKS_EXPORTER_INFO_FIELDS_EXCLUDE", ""), "Regex of the <section>_<field> names to skip with --export-all-info-fields")
+		metricNaming        = flag.String("metric-naming", getEnv("KVROCKS_EXPORTER_METRIC_NAMING", "legacy"), "Metric names to export, valid options are legacy, v2 (Prometheus conventions) and both")
+		replay              = flag.String("replay", getEnv("KVROCKS_EXPORTER_REPLAY", ""), "Capture bundle to serve the metrics from instead of connecting to the Kvrocks instance")
+		output              = flag.String("output", getEnv("KVROCKS_EXPORTER_OUTPUT", "-"), "Where the capture and once commands write to, - for stdout")
+		outputFormat        = flag.String("output-format", getEnv("KVROCKS_EXPORTER_OUTPUT_FORMAT", "text"), "Format of the metrics written by the once command, valid options are text and openmetrics")
+		textfile            = flag.String("textfile", getEnv("KVROCKS_EXPORTER_TEXTFILE", ""), "Scrape once and write the metrics to this file for the textfile collector of the node_exporter, same as once --output=<file>")
+		pushURL             = flag.String("push.url", getEnv("KVROCKS_EXPORTER_PUSH_URL", ""), "URL of a Pushgateway to push the metrics to")
+		pushInterval        = flag.String("push.interval", getEnv("KVROCKS_EXPORTER_PUSH_INTERVAL", "15s"), "Interval of the pushes to the Pushgateway")
+		pushJob             = flag.String("push.job", getEnv("KVROCKS_EXPORTER_PUSH_JOB", "kvrocks_exporter"), "Job name of the pushed metrics")
+		pushGrouping        = flag.String("push.grouping", getEnv("KVROCKS_EXPORTER_PUSH_GROUPING", ""), "Grouping labels of the pushed metrics on top of instance and cluster, like dc=eu,cluster=orders")
+		pushGroupByRole     = flag.Bool("push.group-by-role", getEnvBool("KVROCKS_EXPORTER_PUSH_GROUP_BY_ROLE", false), "Whether to add the role of the instance to the grouping labels of the pushed metrics")
+		pushUsername        = flag.String("push.username", getEnv("KVROCKS_EXPORTER_PUSH_USERNAME", ""), "Username for basic auth on the Pushgateway")
+		pushPassword        = flag.String("push.password", getEnv("KVROCKS_EXPORTER_PUSH_PASSWORD", ""), "Password for basic auth on the Pushgateway")
+		pushTLSCaCertFile   = flag.String("push.tls-ca-cert-file", getEnv("KVROCKS_EXPORTER_PUSH_TLS_CA_CERT_FILE", ""), "Name of the CA certificate file (including full path) to verify the Pushgateway")
+		pushTLSCertFile     = flag.String("push.tls-client-cert-file", getEnv("KVROCKS_EXPORTER_PUSH_TLS_CLIENT_CERT_FILE", ""), "Name of the client certificate file (including full path) if the Pushgateway requires TLS client authentication")
+		pushTLSKeyFile      = flag.String("push.tls-client-key-file", getEnv("KVROCKS_EXPORTER_PUSH_TLS_CLIENT_KEY_FILE", ""), "Name of the client key file (including full path) if the Pushgateway requires TLS client authentication")
+		pushSkipTLSVerify   = flag.Bool("push.skip-tls-verification", getEnvBool("KVROCKS_EXPORTER_PUSH_SKIP_TLS_VERIFICATION", false), "Whether to skip TLS verification of the Pushgateway")
+		configFile          = flag.String("config-file", getEnv("KVROCKS_EXPORTER_CONFIG_FILE", ""), "JSON config file of the exporter, e.g. with the targets to scrape on /metrics and the commands to run")
+		targetWorkers       = flag.Int("scrape-workers", getEnvInt("KVROCKS_EXPORTER_SCRAPE_WORKERS", 8), "Number of targets scraped at the same time on /metrics when scraping several targets")
+		checkStreams        = flag.String("check-streams", getEnv("KVROCKS_EXPORTER_CHECK_STREAMS", ""), "Comma separated list of stream key patterns to export the length, consumer groups and consumers of, e.g. queue:*")
+		maxStreamKeys       = flag.Int("max-stream-keys", getEnvInt("KVROCKS_EXPORTER_MAX_STREAM_KEYS", 100), "Maximum number of stream keys matching --check-streams to export")
+		checkSearchIndexes  = flag.Bool("check-search-indexes", getEnvBool("KVROCKS_EXPORTER_CHECK_SEARCH_INDEXES", false), "Whether to export the search indexes listed by FT._LIST with FT.INFO")
+		checkBloomFilters   = flag.String("check-bloom-filters", getEnv("KVROCKS_EXPORTER_CHECK_BLOOM_FILTERS", ""), "Comma separated list of bloom filter keys or key patterns to export BF.INFO of")
+		checkHyperLogLogs   = flag.String("check-hyperloglogs", getEnv("KVROCKS_EXPORTER_CHECK_HYPERLOGLOGS", ""), "Comma separated list of HyperLogLog keys or key patterns to export PFCOUNT of")
+		bigKeysScanBudget   = flag.Int("big-keys.scan-budget", getEnvInt("KVROCKS_EXPORTER_BIG_KEYS_SCAN_BUDGET", 0), "Number of keys the big key sampler scans per scrape, 0 disables it")
+		bigKeysTopK         = flag.Int("big-keys.top-k", getEnvInt("KVROCKS_EXPORTER_BIG_KEYS_TOP_K", 10), "Number of the biggest keys per type exported by the big key sampler")
+		keyspaceBudget      = flag.Int("keyspace.sample-budget", getEnvInt("KVROCKS_EXPORTER_KEYSPACE_SAMPLE_BUDGET", 0), "Number of keys the keyspace sampler scans per scrape to group them by prefix, 0 disables it")
+		keyspaceDelimiter   = flag.String("keyspace.prefix-delimiter", getEnv("KVROCKS_EXPORTER_KEYSPACE_PREFIX_DELIMITER", ":"), "Delimiter of the parts of the keys grouped by the keyspace sampler")
+		keyspaceDepth       = flag.Int("keyspace.prefix-depth", getEnvInt("KVROCKS_EXPORTER_KEYSPACE_PREFIX_DEPTH", 1), "Number of parts of the keys making up their prefix")
+		keyspaceRegex       = flag.String("keyspace.prefix-regex", getEnv("KVROCKS_EXPORTER_KEYSPACE_PREFIX_REGEX", ""), "Regex of the prefix of the keys instead of the delimiter, the capture groups joined by the delimiter are the prefix")
+		keyspaceMaxPrefixes = flag.Int("keyspace.max-prefixes", getEnvInt("KVROCKS_EXPORTER_KEYSPACE_MAX_PREFIXES", 50), "Maximum number of prefixes exported by the keyspace sampler, the keys of other prefixes are counted as other")
+		scriptPaths         = flag.String("script", getEnv("KVROCKS_EXPORTER_SCRIPT", ""), "Comma separated list of Lua script files to run on every scrape, they return name/value pairs exported as gauges")
+		scriptTimeout       = flag.String("script-timeout", getEnv("KVROCKS_EXPORTER_SCRIPT_TIMEOUT", "5s"), "Timeout for running a Lua script")
+		stateFile           = flag.String("state-file", getEnv("KVROCKS_EXPORTER_STATE_FILE", ""), "File to keep the restarts, role and master changes and the last successful backups seen by the exporter in, so they survive restarts of the exporter")
+		notifyWebhooks      = flag.String("notify.webhook-url", getEnv("KVROCKS_EXPORTER_NOTIFY_WEBHOOK_URL", ""), "Comma separated list of webhook URLs to post events like role changes or a master link going down to as JSON")
+		notifyRetries       = flag.Int("notify.webhook-retries", getEnvInt("KVROCKS_EXPORTER_NOTIFY_WEBHOOK_RETRIES", 3), "Number of retries of a failed post of an event to a webhook, with exponential backoff")
+		notifyLog           = flag.Bool("notify.log", getEnvBool("KVROCKS_EXPORTER_NOTIFY_LOG", false), "Whether to log events like role changes or a master link going down as structured log entries")
+		derivedRatios       = flag.Bool("derived-ratios", getEnvBool("KVROCKS_EXPORTER_DERIVED_RATIOS", true), "Whether to export hit ratios and disk, db size and client utilization derived from INFO")
+		diskForecastWindow  = flag.String("disk-forecast.window", getEnv("KVROCKS_EXPORTER_DISK_FORECAST_WINDOW", "0s"), "Window of the used disk size history the disk full forecast is based on, e.g. 6h, 0s disables it")
+		diskSampleInterval  = flag.String("disk-forecast.interval", getEnv("KVROCKS_EXPORTER_DISK_FORECAST_INTERVAL", "1m"), "Interval of the samples of the used disk size history")
+		diskHistoryFile     = flag.String("disk-forecast.history-file", getEnv("KVROCKS_EXPORTER_DISK_FORECAST_HISTORY_FILE", ""), "File to keep the used disk size history in, so it survives restarts of the exporter")
+		legacyWriteStalls   = flag.Bool("legacy-write-stall-metrics", getEnvBool("KVROCKS_EXPORTER_LEGACY_WRITE_STALL_METRICS", false), "Whether to also export the deprecated level0_file_limit_slowdown and other write stall gauges next to write_stalls_total")
+		clusterWorkers      = flag.Int("cluster.scrape-workers", getEnvInt("KVROCKS_EXPORTER_CLUSTER_SCRAPE_WORKERS", 8), "Number of nodes scraped at the same time by /scrape_cluster")
+		discoverReplicas    = flag.Bool("discover-replicas", getEnvBool("KVROCKS_EXPORTER_DISCOVER_REPLICAS", false), "Whether to also scrape the replicas of a sentinel:// or controller:// target")
 	)
 	flag.Parse()
 
+	if *textfile != "" {
+		if command != "" && command != "once" {
+			log.Fatalf("--textfile can't be used with the %s command", command)
+		}
+		command = "once"
+		*output = *textfile
+	}
+
+	switch command {
+	case "", "capture", "once":
+	default:
+		log.Fatalf("Unknown command %q, valid commands are: capture and once", command)
+	}
+
+	switch *outputFormat {
+	case "text", "openmetrics":
+	default:
+		log.Fatalf("Invalid output format %q, valid options are text and openmetrics", *outputFormat)
+	}
+
 	switch *logFormat {
 	case "json":
 		log.SetFormatter(&log.JSONFormatter{})
@@ -103,11 +214,77 @@ func main() {
 		}
 	}
 
+	var luaScripts map[string][]byte
+	if *scriptPaths != "" {
+		luaScripts = map[string][]byte{}
+		for _, path := range strings.Split(*scriptPaths, ",") {
+			if luaScripts[path], err = os.ReadFile(path); err != nil {
+				log.Fatalf("Error loading script file %s, err: %s", path, err)
+			}
+		}
+	}
+	scriptTo, err := time.ParseDuration(*scriptTimeout)
+	if err != nil {
+		log.Fatalf("Couldn't parse script timeout duration, err: %s", err)
+	}
+
+	forecastWindow, err := time.ParseDuration(*diskForecastWindow)
+	if err != nil {
+		log.Fatalf("Couldn't parse disk forecast window, err: %s", err)
+	}
+	forecastInterval, err := time.ParseDuration(*diskSampleInterval)
+	if err != nil {
+		log.Fatalf("Couldn't parse disk forecast interval, err: %s", err)
+	}
+
+	var notifiers []exporter.Notifier
+	for _, u := range splitAddrs(*notifyWebhooks) {
+		notifiers = append(notifiers, exporter.NewWebhookNotifier(exporter.WebhookOptions{URL: u, Retries: *notifyRetries}))
+	}
+	if *notifyLog {
+		notifiers = append(notifiers, exporter.LogNotifier{})
+	}
+
+	var replayBundle *exporter.CaptureBundle
+	if *replay != "" {
+		replayBundle, err = exporter.LoadCaptureBundle(*replay)
+		if err != nil {
+			log.Fatalf("Error loading capture bundle, err: %s", err)
+		}
+	}
+
+	addrs := splitAddrs(*redisAddr)
+	var customCommands []exporter.CommandConfig
+	if *configFile != "" {
+		cfg, err := exporter.LoadConfigFile(*configFile)
+		if err != nil {
+			log.Fatalf("Error loading config file %s, err: %s", *configFile, err)
+		}
+		if len(cfg.Targets) > 0 && !isAddrSet() {
+			// the default address isn't scraped next to the targets of the config file
+			addrs = nil
+		}
+		addrs = append(addrs, cfg.Targets...)
+		customCommands = cfg.Commands
+	}
+
+	// a single target is scraped without target label, like before multiple targets were supported
+	kvrocksAddr, targets := "", addrs
+	if len(addrs) == 1 {
+		kvrocksAddr, targets = addrs[0], nil
+	}
+	if command == "capture" && len(targets) > 0 {
+		log.Fatal("The capture command needs a single Kvrocks instance")
+	}
+
 	registry := prometheus.NewRegistry()
-	registry = prometheus.DefaultRegisterer.(*prometheus.Registry)
+	if command != "once" {
+		// once only writes the kvrocks metrics, the Go and process metrics are left to e.g. the node_exporter
+		registry = prometheus.DefaultRegisterer.(*prometheus.Registry)
+	}
 
 	exp, err := exporter.NewKvrocksExporter(
-		*redisAddr,
+		kvrocksAddr,
 		exporter.Options{
 			Password:              *kvrocksPwd,
 			PasswordMap:           passwordMap,
@@ -124,6 +301,38 @@ func main() {
 			ConnectionTimeouts:    to,
 			MetricsPath:           *metricPath,
 			PingOnConnect:         *pingOnConnect,
+			DiscoverReplicas:      *discoverReplicas,
+			ControllerAddr:        *controllerAddr,
+			ExportAllInfoFields:   *exportAllInfoFields,
+			InfoFieldsInclude:     *infoFieldsInclude,
+			InfoFieldsExclude:     *infoFieldsExclude,
+			MetricNaming:          *metricNaming,
+			ReplayBundle:          replayBundle,
+			ClusterScrapeWorkers:  *clusterWorkers,
+			Targets:               targets,
+			TargetScrapeWorkers:   *targetWorkers,
+			CheckStreams:          *checkStreams,
+			MaxStreamKeys:         *maxStreamKeys,
+			CheckSearchIndexes:    *checkSearchIndexes,
+			CheckBloomFilters:     *checkBloomFilters,
+			CheckHyperLogLogs:     *checkHyperLogLogs,
+			BigKeysScanBudget:     *bigKeysScanBudget,
+			BigKeysTopK:           *bigKeysTopK,
+			KeyspaceSampleBudget:  *keyspaceBudget,
+			KeyspaceDelimiter:     *keyspaceDelimiter,
+			KeyspacePrefixDepth:   *keyspaceDepth,
+			KeyspacePrefixRegex:   *keyspaceRegex,
+			KeyspaceMaxPrefixes:   *keyspaceMaxPrefixes,
+			LuaScripts:            luaScripts,
+			ScriptTimeout:         scriptTo,
+			CustomCommands:        customCommands,
+			StateFile:             *stateFile,
+			Notifiers:             notifiers,
+			DerivedRatios:         *derivedRatios,
+			DiskForecastWindow:    forecastWindow,
+			DiskForecastInterval:  forecastInterval,
+			DiskForecastFile:      *diskHistoryFile,
+			LegacyWriteStalls:     *legacyWriteStalls,
 			Registry:              registry,
 			BuildInfo: exporter.BuildInfo{
 				Version:   BuildVersion,
@@ -145,6 +354,69 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if command == "capture" {
+		bundle, err := exp.Capture()
+		if err != nil {
+			log.Fatalf("Couldn't capture %s, err: %s", *redisAddr, err)
+		}
+		if *output == "-" {
+			err = bundle.Write(os.Stdout)
+		} else {
+			err = bundle.WriteFile(*output)
+		}
+		if err != nil {
+			log.Fatalf("Couldn't write capture bundle, err: %s", err)
+		}
+		return
+	}
+
+	if command == "once" {
+		var up bool
+		openMetrics := *outputFormat == "openmetrics"
+		if *output == "-" {
+			up, err = exp.WriteMetrics(os.Stdout, openMetrics)
+		} else {
+			up, err = exp.WriteMetricsFile(*output, openMetrics)
+		}
+		if err != nil {
+			log.Fatalf("Couldn't write all metrics, err: %s", err)
+		}
+		if !up {
+			log.Errorf("Kvrocks instance %s is down", *redisAddr)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *pushURL != "" {
+		interval, err := time.ParseDuration(*pushInterval)
+		if err != nil {
+			log.Fatalf("Couldn't parse push interval, err: %s", err)
+		}
+		grouping, err := exporter.ParseGrouping(*pushGrouping)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pusher, err := exporter.NewPusher(exp, exporter.PushOptions{
+			URL:                 *pushURL,
+			Job:                 *pushJob,
+			Interval:            interval,
+			Username:            *pushUsername,
+			Password:            *pushPassword,
+			CaCertFile:          *pushTLSCaCertFile,
+			ClientCertFile:      *pushTLSCertFile,
+			ClientKeyFile:       *pushTLSKeyFile,
+			SkipTLSVerification: *pushSkipTLSVerify,
+			GroupByRole:         *pushGroupByRole,
+			Grouping:            grouping,
+		})
+		if err != nil {
+			log.Fatalf("Couldn't set up pushing to %s, err: %s", *pushURL, err)
+		}
+		log.Infof("Pushing metrics to %s every %s", *pushURL, interval)
+		go pusher.Run(context.Background())
+	}
+
 	log.Infof("Providing metrics at %s%s", *listenAddress, *metricPath)
 	log.Debugf("Configured redis addr: %#v", *redisAddr)
 	if *tlsServerCertFile != "" && *tlsServerKeyFile != "" {